@@ -0,0 +1,287 @@
+package sculpt
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/tiredkangaroo/sculpt/internals/sql"
+)
+
+// Aggregation is an aggregate function over a column, such as SUM or COUNT, used with
+// Aggregate.
+type Aggregation struct {
+	// function is the SQL aggregate function.
+	function string
+
+	// column is the column the function is over. It is empty for COUNT(*).
+	column string
+
+	// as is the name of the field of the result struct the value is scanned into.
+	as string
+}
+
+// Count returns an Aggregation that counts the rows, using COUNT(*). Its value is scanned
+// into the field named Count, unless As is used.
+func Count() Aggregation {
+	return Aggregation{function: "COUNT"}
+}
+
+// CountOf returns an Aggregation that counts the rows where the column is not null. Its
+// value is scanned into the field named Count followed by the column, unless As is used.
+func CountOf(column string) Aggregation {
+	return Aggregation{function: "COUNT", column: column}
+}
+
+// Sum returns an Aggregation that sums the values of the column. Its value is scanned into
+// the field named Sum followed by the column, unless As is used.
+func Sum(column string) Aggregation {
+	return Aggregation{function: "SUM", column: column}
+}
+
+// Avg returns an Aggregation that averages the values of the column. Its value is scanned
+// into the field named Avg followed by the column, unless As is used.
+func Avg(column string) Aggregation {
+	return Aggregation{function: "AVG", column: column}
+}
+
+// Min returns an Aggregation of the smallest value of the column. Its value is scanned into
+// the field named Min followed by the column, unless As is used.
+func Min(column string) Aggregation {
+	return Aggregation{function: "MIN", column: column}
+}
+
+// Max returns an Aggregation of the largest value of the column. Its value is scanned into
+// the field named Max followed by the column, unless As is used.
+func Max(column string) Aggregation {
+	return Aggregation{function: "MAX", column: column}
+}
+
+// As returns a copy of the Aggregation whose value is scanned into the named field of the
+// result struct.
+func (a Aggregation) As(field string) Aggregation {
+	a.as = field
+	return a
+}
+
+// String returns the SQL expression of the Aggregation, such as SUM(Age). It can be used as
+// the name given to a Condition used with AggregateQuery.Having.
+func (a Aggregation) String() string {
+	if a.column == "" {
+		return a.function + "(*)"
+	}
+	return fmt.Sprintf("%s(%s)", a.function, a.column)
+}
+
+// expression returns the SQL of the Aggregation, with its column quoted. The column is
+// resolved with resolve, and an error is returned if it does not exist.
+func (a Aggregation) expression(resolve resolver) (string, error) {
+	if a.column == "" {
+		if a.function != "COUNT" {
+			return "", fmt.Errorf("%s requires a column", a.function)
+		}
+		return "COUNT(*)", nil
+	}
+	column, err := resolve(a.column)
+	if err != nil {
+		return "", fmt.Errorf("cannot use %s on %s: %v", a.function, a.column, err)
+	}
+	return fmt.Sprintf("%s(%s)", a.function, column), nil
+}
+
+// field returns the name of the field of the result struct the value is scanned into.
+func (a Aggregation) field() string {
+	if a.as != "" {
+		return a.as
+	}
+	return a.function[:1] + strings.ToLower(a.function[1:]) + unqualified(a.column)
+}
+
+// unqualified returns the name of a column without the name of its model, if it is
+// qualified as in Customer.Name.
+func unqualified(name string) string {
+	if _, column, ok := strings.Cut(name, "."); ok {
+		return column
+	}
+	return name
+}
+
+// AggregateQuery is a query of aggregate values, made with Aggregate, whose results are
+// scanned into R.
+type AggregateQuery[T any, R any] struct {
+	query        *Query[T]
+	aggregations []Aggregation
+	groupby      []string
+	having       []Condition
+}
+
+// Aggregate makes an AggregateQuery from the query, whose results are the aggregations
+// over the rows that meet the query's conditions, scanned into R. The ordering, limit and
+// offset of the query are also used, as are its joins, whose columns can be aggregated and
+// grouped by when qualified with the name of their model (see Query.Join).
+//
+// R must be a struct with a field for each aggregation, and for each column given to GroupBy,
+// with the same name (without the name of the model, if qualified).
+//
+//	type AgeByName struct {
+//		Name   string
+//		Count  int64
+//		AvgAge float64
+//	}
+//	results, err := sculpt.Aggregate[AgeByName](userModel.Query(), sculpt.Count(), sculpt.Avg("Age")).
+//		GroupBy("Name").
+//		Do()
+func Aggregate[R any, T any](q *Query[T], aggregations ...Aggregation) *AggregateQuery[T, R] {
+	return &AggregateQuery[T, R]{query: q, aggregations: aggregations}
+}
+
+// GroupBy groups the rows by the columns, so that an aggregate value is found for each group.
+func (aq *AggregateQuery[T, R]) GroupBy(columns ...string) *AggregateQuery[T, R] {
+	aq.groupby = append(aq.groupby, columns...)
+	return aq
+}
+
+// Having adds conditions on the groups, which are combined in the same way as the conditions
+// of a query. To use an aggregate value in a condition, use the String method of the
+// Aggregation as the name given to the condition.
+//
+//	Having(sculpt.GreaterThan(sculpt.Count().String(), 10))
+func (aq *AggregateQuery[T, R]) Having(c ...Condition) *AggregateQuery[T, R] {
+	aq.having = append(aq.having, c...)
+	return aq
+}
+
+// aggregationPattern matches the String of an Aggregation, such as SUM(Age) or COUNT(*).
+var aggregationPattern = regexp.MustCompile(`^(COUNT|SUM|AVG|MIN|MAX)\((\*|\w+(?:\.\w+)?)\)$`)
+
+// resolve resolves a name given to a condition used with Having. The name is either a
+// column of the model, the String of an Aggregation, such as SUM(Age), or the name of the
+// field of R an aggregation of the query is scanned into.
+func (aq *AggregateQuery[T, R]) resolve(name string) (string, error) {
+	if column, err := aq.query.resolve(name); err == nil {
+		return column, nil
+	}
+	for _, aggregation := range aq.aggregations {
+		if aggregation.as != "" && aggregation.as == name {
+			return aggregation.expression(aq.query.resolve)
+		}
+	}
+
+	match := aggregationPattern.FindStringSubmatch(name)
+	if match == nil {
+		return "", fmt.Errorf("not a field on the model %s or an aggregation", aq.query.model.name)
+	}
+	aggregation := Aggregation{function: match[1]}
+	if match[2] != "*" {
+		aggregation.column = match[2]
+	}
+	return aggregation.expression(aq.query.resolve)
+}
+
+// compile makes a SQL statement for pgx from the aggregate query, and returns it with the
+// pgx arguments for it and the names of the fields of R each value is scanned into.
+func (aq *AggregateQuery[T, R]) compile() (string, []any, []string, error) {
+	q := aq.query
+	if q.err != nil {
+		return "", nil, nil, q.err
+	}
+	if len(aq.aggregations) == 0 {
+		return "", nil, nil, fmt.Errorf("an aggregate query requires at least one aggregation")
+	}
+
+	expressions := []string{}
+	fields := []string{}
+	groupby := []string{}
+	for _, column := range aq.groupby {
+		identifier, err := q.resolve(column)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("cannot group by %s: %v", column, err)
+		}
+		expressions = append(expressions, identifier)
+		fields = append(fields, unqualified(column))
+		groupby = append(groupby, identifier)
+	}
+	for _, aggregation := range aq.aggregations {
+		expression, err := aggregation.expression(q.resolve)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		expressions = append(expressions, expression)
+		fields = append(fields, aggregation.field())
+	}
+
+	statement := fmt.Sprintf("SELECT %s %s", strings.Join(expressions, ", "), q.from())
+	j := 0 // uses a counter to replace placeholders for pgx
+	where, a, err := q.compileWhere(&j)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	statement += where
+
+	if len(groupby) > 0 {
+		statement += " GROUP BY " + strings.Join(groupby, ", ")
+	}
+	if len(aq.having) > 0 {
+		having, ha, err := compileConditions(aq.having, aq.resolve, &j)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		statement += " HAVING " + having
+		a = append(a, ha...)
+	}
+
+	order, oa := q.compileOrder(&j)
+	statement += order
+	a = append(a, oa...)
+
+	statement += ";"
+	return statement, a, fields, nil
+}
+
+// Do compiles and executes the aggregate query and returns the results.
+func (aq *AggregateQuery[T, R]) Do() ([]R, error) {
+	return aq.DoContext(context.Background())
+}
+
+// DoContext is like Do, but uses the given context for the query.
+func (aq *AggregateQuery[T, R]) DoContext(ctx context.Context) ([]R, error) {
+	rt := reflect.TypeFor[R]()
+	if rt.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("type parameter R must be a struct")
+	}
+	statement, a, fields, err := aq.compile()
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		if _, ok := rt.FieldByName(field); !ok {
+			return nil, fmt.Errorf("result type %s does not have the field %s", rt.Name(), field)
+		}
+	}
+
+	e, err := aq.query.model.executor()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := sql.Query(ctx, e, statement, a...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []R{}
+	for rows.Next() {
+		result := reflect.New(rt).Elem()
+		targets := make([]any, len(fields))
+		for i, field := range fields {
+			targets[i] = result.FieldByName(field).Addr().Interface()
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return nil, err
+		}
+		results = append(results, result.Interface().(R))
+	}
+	return results, rows.Err()
+}
@@ -0,0 +1,187 @@
+package sculpt
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/tiredkangaroo/sculpt/internals/sql"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Batch queues statements from models and queries so that they are sent to Postgres in
+// one round trip. A Batch is made with DB.Batch or Tx.Batch, and is sent once with Send.
+type Batch struct {
+	e     sql.Executor
+	items []*batchItem
+}
+
+// batchItem is a statement queued in a Batch.
+type batchItem struct {
+	statement string
+	a         []any
+
+	// err is an error that happened while queueing the statement, such as a failed
+	// validation. The statement is not sent if it is set.
+	err error
+
+	// exec handles the command tag of a statement that does not return rows.
+	exec func(tag pgconn.CommandTag) error
+
+	// query handles the rows of a statement that returns rows. It is set instead of exec.
+	query func(rows pgx.Rows) error
+
+	result *BatchResult
+}
+
+// BatchResult is the result of a statement in a Batch. It is set once the Batch is sent.
+type BatchResult struct {
+	// RowsAffected is the number of rows affected by the statement.
+	RowsAffected int64
+
+	// Err is the error from the statement, if any.
+	Err error
+}
+
+// QueuedQuery is a query queued in a Batch. Its results are available once the Batch
+// is sent.
+type QueuedQuery[T any] struct {
+	BatchResult
+	results []T
+}
+
+// Results returns the results of the query, or the error from the query.
+func (qq *QueuedQuery[T]) Results() ([]T, error) {
+	return qq.results, qq.Err
+}
+
+// Batch makes a new Batch, whose statements are run on the DB when sent.
+func (db *DB) Batch() *Batch {
+	return &Batch{e: db.pool}
+}
+
+// Batch makes a new Batch, whose statements are run inside of the transaction when sent.
+func (tx *Tx) Batch() *Batch {
+	return &Batch{e: tx.tx}
+}
+
+// queue queues an item in the batch and returns its result.
+func (b *Batch) queue(item *batchItem) *BatchResult {
+	if item.result == nil {
+		item.result = new(BatchResult)
+	}
+	b.items = append(b.items, item)
+	return item.result
+}
+
+// Len returns the number of statements queued in the batch.
+func (b *Batch) Len() int {
+	return len(b.items)
+}
+
+// Send sends every queued statement to Postgres in one round trip. See SendContext for
+// more information.
+func (b *Batch) Send() ([]BatchResult, error) {
+	return b.SendContext(context.Background())
+}
+
+// SendContext sends every queued statement to Postgres in one round trip, using the given
+// context, and returns the result of each statement in the order they were queued. The
+// error returned is the error of the first statement that failed.
+//
+// Unless the Batch was made with Tx.Batch, the statements run in an implicit transaction,
+// and so a failed statement causes the statements after it to fail as well.
+func (b *Batch) SendContext(ctx context.Context) ([]BatchResult, error) {
+	pb := &pgx.Batch{}
+	for _, item := range b.items {
+		if item.err == nil {
+			pb.Queue(item.statement, item.a...)
+		}
+	}
+
+	var br pgx.BatchResults
+	if pb.Len() > 0 {
+		br = sql.SendBatch(ctx, b.e, pb)
+		defer br.Close()
+	}
+
+	results := make([]BatchResult, len(b.items))
+	var first error
+	for i, item := range b.items {
+		if item.err == nil {
+			item.err = item.read(br)
+		}
+		item.result.Err = item.err
+		results[i] = *item.result
+		if item.err != nil && first == nil {
+			first = fmt.Errorf("batch statement %d: %w", i, item.err)
+		}
+	}
+	return results, first
+}
+
+// read reads the result of the item from the batch results.
+func (item *batchItem) read(br pgx.BatchResults) error {
+	if item.query != nil {
+		rows, err := br.Query()
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		return item.query(rows)
+	}
+
+	tag, err := br.Exec()
+	if err != nil {
+		return err
+	}
+	item.result.RowsAffected = tag.RowsAffected()
+	if item.exec != nil {
+		return item.exec(tag)
+	}
+	return nil
+}
+
+// QueueSave queues saving the struct into the database table in the batch. See Save for
+// more information.
+func (m *Model[T]) QueueSave(b *Batch, v T) *BatchResult {
+	statement, a, _, err := m.compileSave(reflect.ValueOf(v), false)
+	return b.queue(&batchItem{statement: statement, a: a, err: err})
+}
+
+// QueueUpdate queues updating the row with the struct's primary key in the batch. See
+// Update for more information.
+func (m *Model[T]) QueueUpdate(b *Batch, v T) *BatchResult {
+	statement, a, err := m.compileUpdate(reflect.ValueOf(v))
+	return b.queue(&batchItem{statement: statement, a: a, err: err, exec: expectRows})
+}
+
+// QueueDelete queues deleting the row with the struct's primary key in the batch. See
+// Delete for more information.
+func (m *Model[T]) QueueDelete(b *Batch, v T) *BatchResult {
+	statement, a, err := m.compileDelete(reflect.ValueOf(v))
+	return b.queue(&batchItem{statement: statement, a: a, err: err, exec: expectRows})
+}
+
+// Queue queues the query in the batch. Its results are available from the returned
+// QueuedQuery once the batch is sent. Relations cannot be loaded with Preload in a batch.
+func (q *Query[T]) Queue(b *Batch) *QueuedQuery[T] {
+	qq := new(QueuedQuery[T])
+	statement, a, err := q.compile()
+	if err == nil && len(q.preloads) > 0 {
+		err = fmt.Errorf("cannot queue a query with preloaded relations")
+	}
+	b.queue(&batchItem{
+		statement: statement,
+		a:         a,
+		err:       err,
+		query: func(rows pgx.Rows) (err error) {
+			qq.results, err = q.scan(rows)
+			return err
+		},
+		result: &qq.BatchResult,
+	})
+	return qq
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// sculptPath is the import path of the sculpt package.
+const sculptPath = "github.com/tiredkangaroo/sculpt"
+
+// modelDirective marks a struct as a model, when gen is not given the types to generate for.
+const modelDirective = "//sculpt:model"
+
+// gen generates typed column references for the models in a package. For each model, a
+// variable named after the model followed by Cols is generated, holding a sculpt.Col (or
+// sculpt.StringCol) for each field:
+//
+//	var UserCols = struct {
+//		ID   sculpt.Col[int]
+//		Name sculpt.StringCol
+//	}{...}
+//
+// The models are the types given with -type, or the structs marked with //sculpt:model.
+func gen(args []string) error {
+	flags := flag.NewFlagSet("gen", flag.ContinueOnError)
+	typesFlag := flags.String("type", "", "comma-separated list of model types; defaults to structs marked with "+modelDirective)
+	output := flags.String("output", "sculpt_cols.go", "name of the generated file, in the package directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	dir := "."
+	if flags.NArg() > 0 {
+		dir = flags.Arg(0)
+	}
+	var types []string
+	if *typesFlag != "" {
+		types = strings.Split(*typesFlag, ",")
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != *output
+	}, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	if len(pkgs) != 1 {
+		return fmt.Errorf("expected one package in %s, found %d", dir, len(pkgs))
+	}
+
+	g := &generator{dir: dir, imports: map[string]string{}, names: map[string]string{}}
+	for _, pkg := range pkgs {
+		g.pkg = pkg.Name
+		files := make([]string, 0, len(pkg.Files))
+		for name := range pkg.Files {
+			files = append(files, name)
+		}
+		slices.Sort(files) // generate in a stable order
+		for _, name := range files {
+			if err := g.file(pkg.Files[name], types); err != nil {
+				return err
+			}
+		}
+	}
+	for _, t := range types {
+		if !slices.Contains(g.found, t) {
+			return fmt.Errorf("type %s is not a struct in %s", t, dir)
+		}
+	}
+	if len(g.found) == 0 {
+		return fmt.Errorf("no models found in %s", dir)
+	}
+
+	src, err := g.source()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, *output), src, 0o644)
+}
+
+// generator collects the generated column references of the models in a package.
+type generator struct {
+	// pkg is the name of the package.
+	pkg string
+
+	// dir is the directory of the package, which its imports are resolved from.
+	dir string
+
+	// imports maps the names of packages used by the generated code to their paths.
+	imports map[string]string
+
+	// names maps import paths to the names declared by the packages, see packageName.
+	names map[string]string
+
+	// found is the names of the models generated for.
+	found []string
+
+	body bytes.Buffer
+}
+
+// file generates for the models in the file. If types is empty, the models are the structs
+// marked with the model directive.
+func (g *generator) file(f *ast.File, types []string) error {
+	// the names that the file's imports are referred to by
+	imports := map[string]string{}
+	for _, spec := range f.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		var name string
+		switch {
+		case spec.Name == nil:
+			name = g.packageName(p)
+		case spec.Name.Name == "_" || spec.Name.Name == ".":
+			continue // not referred to by a name
+		default:
+			name = spec.Name.Name
+		}
+		imports[name] = p
+	}
+
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok || ts.TypeParams != nil {
+				continue
+			}
+			doc := ts.Doc
+			if doc == nil && len(gd.Specs) == 1 {
+				doc = gd.Doc
+			}
+			if len(types) > 0 && !slices.Contains(types, ts.Name.Name) {
+				continue
+			}
+			if len(types) == 0 && !hasDirective(doc) {
+				continue
+			}
+			if err := g.model(ts.Name.Name, st, imports); err != nil {
+				return fmt.Errorf("model %s: %v", ts.Name.Name, err)
+			}
+			g.found = append(g.found, ts.Name.Name)
+		}
+	}
+	return nil
+}
+
+// packageName returns the name declared by the package with the import path p, which is
+// the name it is referred to by when imported without one. If the package cannot be found
+// from the directory of the package being generated for, the name is assumed from the path.
+func (g *generator) packageName(p string) string {
+	if name, ok := g.names[p]; ok {
+		return name
+	}
+	name := assumedName(p)
+	ctxt := build.Default
+	ctxt.Dir = g.dir // look the package up in the module of the directory
+	if pkg, err := ctxt.Import(p, g.dir, 0); err == nil {
+		name = pkg.Name
+	}
+	g.names[p] = name
+	return name
+}
+
+// assumedName returns the name that a package with the import path p is assumed to have: the
+// last element of the path, without a major version suffix (such as /v5), a go- prefix, or
+// anything after the first character that cannot be in an identifier (such as .v3).
+func assumedName(p string) string {
+	base := path.Base(p)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil && path.Dir(p) != "." {
+			base = path.Base(path.Dir(p))
+		}
+	}
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, func(r rune) bool {
+		return r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+// hasDirective returns whether the comments contain the model directive.
+func hasDirective(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if strings.TrimSpace(c.Text) == modelDirective {
+			return true
+		}
+	}
+	return false
+}
+
+// model generates the column references of a model.
+func (g *generator) model(name string, st *ast.StructType, imports map[string]string) error {
+	type column struct {
+		name string
+		typ  string // the type of the Col
+		init string // the expression making the Col
+	}
+	columns := []column{}
+
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			return fmt.Errorf("embedded fields are not supported")
+		}
+		if isRelation(field) {
+			continue
+		}
+		vt := field.Type
+		if optional := g.optionalValue(field.Type, imports); optional != nil {
+			vt = optional
+		}
+		v, err := g.typeString(vt, imports)
+		if err != nil {
+			return fmt.Errorf("field %s: %v", field.Names[0].Name, err)
+		}
+		for _, ident := range field.Names {
+			c := column{
+				name: ident.Name,
+				typ:  fmt.Sprintf("sculpt.Col[%s]", v),
+				init: fmt.Sprintf("sculpt.NewCol[%s](%q)", v, ident.Name),
+			}
+			if v == "string" {
+				c.typ = "sculpt.StringCol"
+				c.init = fmt.Sprintf("sculpt.NewStringCol(%q)", ident.Name)
+			}
+			columns = append(columns, c)
+		}
+	}
+
+	fmt.Fprintf(&g.body, "\n// %sCols holds typed references to the columns of %s.\n", name, name)
+	fmt.Fprintf(&g.body, "var %sCols = struct {\n", name)
+	for _, c := range columns {
+		fmt.Fprintf(&g.body, "\t%s %s\n", c.name, c.typ)
+	}
+	g.body.WriteString("}{\n")
+	for _, c := range columns {
+		fmt.Fprintf(&g.body, "\t%s: %s,\n", c.name, c.init)
+	}
+	g.body.WriteString("}\n")
+	return nil
+}
+
+// optionalValue returns the type argument of a sculpt.Optional type, or nil if the type is
+// not a sculpt.Optional.
+func (g *generator) optionalValue(t ast.Expr, imports map[string]string) ast.Expr {
+	index, ok := t.(*ast.IndexExpr)
+	if !ok {
+		return nil
+	}
+	x, ok := index.X.(*ast.SelectorExpr)
+	if !ok {
+		return nil
+	}
+	pkg, ok := x.X.(*ast.Ident)
+	if ok && x.Sel.Name == "Optional" && imports[pkg.Name] == sculptPath {
+		return index.Index
+	}
+	return nil
+}
+
+// isRelation reports whether the field is a relation to another model, which is not a column.
+func isRelation(field *ast.Field) bool {
+	if field.Tag == nil {
+		return false
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return false
+	}
+	_, ok := reflect.StructTag(tag).Lookup("relation")
+	return ok
+}
+
+// typeString returns the source of the type, for use in the generated file, recording the
+// imports it needs.
+func (g *generator) typeString(t ast.Expr, imports map[string]string) (string, error) {
+	switch t := t.(type) {
+	case *ast.Ident:
+		return t.Name, nil
+	case *ast.SelectorExpr:
+		pkg, ok := t.X.(*ast.Ident)
+		if !ok {
+			return "", fmt.Errorf("unsupported type")
+		}
+		p, ok := imports[pkg.Name]
+		if !ok {
+			return "", fmt.Errorf("unknown package %s", pkg.Name)
+		}
+		if existing, ok := g.imports[pkg.Name]; ok && existing != p {
+			return "", fmt.Errorf("package name %s refers to both %s and %s", pkg.Name, existing, p)
+		}
+		g.imports[pkg.Name] = p
+		return pkg.Name + "." + t.Sel.Name, nil
+	case *ast.ArrayType:
+		if t.Len != nil {
+			return "", fmt.Errorf("unsupported array type")
+		}
+		elem, err := g.typeString(t.Elt, imports)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + elem, nil
+	default:
+		return "", fmt.Errorf("unsupported type")
+	}
+}
+
+// source returns the formatted source of the generated file.
+func (g *generator) source() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by sculpt gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", g.pkg)
+
+	g.imports["sculpt"] = sculptPath
+	// standard library imports are grouped before the others
+	var std, other []string
+	for name, p := range g.imports {
+		spec := fmt.Sprintf("%q", p)
+		if g.packageName(p) != name {
+			spec = name + " " + spec
+		}
+		if strings.Contains(strings.Split(p, "/")[0], ".") {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	slices.Sort(std)
+	slices.Sort(other)
+	b.WriteString("import (\n")
+	for _, spec := range std {
+		fmt.Fprintf(&b, "\t%s\n", spec)
+	}
+	if len(std) > 0 && len(other) > 0 {
+		b.WriteString("\n")
+	}
+	for _, spec := range other {
+		fmt.Fprintf(&b, "\t%s\n", spec)
+	}
+	b.WriteString(")\n")
+	b.Write(g.body.Bytes())
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %v", err)
+	}
+	return src, nil
+}
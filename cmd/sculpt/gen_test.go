@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"go/format"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// copyModels copies the models of testdata/models into a temporary directory, and returns it.
+func copyModels(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	src, err := os.ReadFile(filepath.Join("testdata", "models", "models.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "models.go"), src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestGenGolden(t *testing.T) {
+	dir := copyModels(t)
+	if err := gen([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "sculpt_cols.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", "models", "sculpt_cols.go")
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("generated file does not match %s (run go test -update to update it):\n%s", golden, got)
+	}
+
+	formatted, err := format.Source(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, formatted) {
+		t.Error("generated file is not gofmt'd")
+	}
+}
+
+func TestGenGoldenCompiles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds a package with the go command")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	out, err := exec.Command(goCmd, "vet", "./testdata/models").CombinedOutput()
+	if err != nil {
+		t.Errorf("testdata/models does not compile: %v\n%s", err, out)
+	}
+}
+
+func TestGenType(t *testing.T) {
+	dir := copyModels(t)
+	if err := gen([]string{"-type", "Note", "-output", "note_cols.go", dir}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "note_cols.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := string(got)
+	if !strings.Contains(src, "var NoteCols = struct {") {
+		t.Errorf("NoteCols is not generated:\n%s", src)
+	}
+	if strings.Contains(src, "CustomerCols") {
+		t.Errorf("CustomerCols is generated without being given with -type:\n%s", src)
+	}
+}
+
+func TestGenErrors(t *testing.T) {
+	dir := copyModels(t)
+	if err := gen([]string{"-type", "Missing", dir}); err == nil {
+		t.Error("gen with a missing type returned no error")
+	}
+	if err := gen([]string{t.TempDir()}); err == nil {
+		t.Error("gen in a directory without a package returned no error")
+	}
+}
+
+func TestGenImportNames(t *testing.T) {
+	dir := t.TempDir()
+	src := `package models
+
+import (
+	"github.com/jackc/pgx/v5"
+	pg "github.com/jackc/pgx/v5/pgtype"
+	"gopkg.in/yaml.v3"
+)
+
+//sculpt:model
+type Document struct {
+	Path pgx.Identifier
+	Body yaml.Node
+	Text pg.Text
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "models.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := gen([]string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "sculpt_cols.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"\t\"github.com/jackc/pgx/v5\"\n",
+		"\tpg \"github.com/jackc/pgx/v5/pgtype\"\n",
+		"\t\"gopkg.in/yaml.v3\"\n",
+		"sculpt.Col[pgx.Identifier]",
+		"sculpt.Col[yaml.Node]",
+		"sculpt.Col[pg.Text]",
+	} {
+		if !strings.Contains(string(got), want) {
+			t.Errorf("generated file does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestPackageName(t *testing.T) {
+	// packages that are not dependencies are looked up without being added to go.mod
+	t.Setenv("GOFLAGS", "-mod=readonly")
+	g := &generator{dir: ".", names: map[string]string{}}
+	tests := []struct {
+		path, want string
+	}{
+		{"time", "time"},
+		{"github.com/jackc/pgx/v5", "pgx"},
+		{"github.com/jackc/pgx/v5/pgtype", "pgtype"},
+		// not dependencies of the module, and so assumed from the path
+		{"gopkg.in/yaml.v3", "yaml"},
+		{"example.com/go-thing/v2", "thing"},
+	}
+	for _, tt := range tests {
+		if got := g.packageName(tt.path); got != tt.want {
+			t.Errorf("packageName(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
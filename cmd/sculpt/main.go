@@ -0,0 +1,44 @@
+// Command sculpt provides tools for working with sculpt models.
+//
+// Usage:
+//
+//	sculpt gen [-type T1,T2] [-output file] [directory]
+//
+// gen generates typed column references for models, see gen.go. It is usually run with
+// go generate:
+//
+//	//go:generate go run github.com/tiredkangaroo/sculpt/cmd/sculpt gen -type User,Order
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "gen":
+		err = gen(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		usage()
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "sculpt: unknown command %s\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sculpt: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: sculpt gen [-type T1,T2] [-output file] [directory]")
+}
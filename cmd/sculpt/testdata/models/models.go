@@ -0,0 +1,36 @@
+// Package models holds the models that gen is tested with.
+package models
+
+import (
+	"time"
+
+	"github.com/tiredkangaroo/sculpt"
+
+	"github.com/google/uuid"
+)
+
+//sculpt:model
+type Customer struct {
+	ID        int `pk:"true" autoincrement:"true"`
+	Name      string
+	Email     sculpt.Optional[string]
+	CreatedAt time.Time
+	Avatar    []byte
+	Orders    []Order `relation:"CustomerID"`
+}
+
+// Order is an order placed by a Customer.
+//
+//sculpt:model
+type Order struct {
+	ID         uuid.UUID `pk:"true"`
+	CustomerID int       `references:"Customer"`
+	Customer   *Customer `relation:"CustomerID"`
+	PlacedAt   sculpt.Optional[time.Time]
+}
+
+// Note is not marked as a model, and so is only generated for when given with -type.
+type Note struct {
+	ID   int
+	Text string
+}
@@ -0,0 +1,36 @@
+// Code generated by sculpt gen. DO NOT EDIT.
+
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tiredkangaroo/sculpt"
+)
+
+// CustomerCols holds typed references to the columns of Customer.
+var CustomerCols = struct {
+	ID        sculpt.Col[int]
+	Name      sculpt.StringCol
+	Email     sculpt.StringCol
+	CreatedAt sculpt.Col[time.Time]
+	Avatar    sculpt.Col[[]byte]
+}{
+	ID:        sculpt.NewCol[int]("ID"),
+	Name:      sculpt.NewStringCol("Name"),
+	Email:     sculpt.NewStringCol("Email"),
+	CreatedAt: sculpt.NewCol[time.Time]("CreatedAt"),
+	Avatar:    sculpt.NewCol[[]byte]("Avatar"),
+}
+
+// OrderCols holds typed references to the columns of Order.
+var OrderCols = struct {
+	ID         sculpt.Col[uuid.UUID]
+	CustomerID sculpt.Col[int]
+	PlacedAt   sculpt.Col[time.Time]
+}{
+	ID:         sculpt.NewCol[uuid.UUID]("ID"),
+	CustomerID: sculpt.NewCol[int]("CustomerID"),
+	PlacedAt:   sculpt.NewCol[time.Time]("PlacedAt"),
+}
@@ -0,0 +1,141 @@
+package sculpt
+
+// Col is a typed reference to a column of a model, whose conditions take values of type V,
+// the type of the column's field (or T, for an Optional[T] field). Using a Col instead of
+// the column's name turns a renamed field, or a value of the wrong type, into a compile
+// error.
+//
+// Cols are usually generated for a model with `sculpt gen`.
+type Col[V any] struct {
+	name string
+}
+
+// NewCol returns a Col referring to the column with the given name.
+func NewCol[V any](name string) Col[V] {
+	return Col[V]{name: name}
+}
+
+// Name returns the name of the column, for use with IncludeFields, OrderBy and other
+// methods that take column names.
+func (c Col[V]) Name() string {
+	return c.name
+}
+
+// Eq returns a Condition that is true when the column is equal to v. See EqualsTo.
+func (c Col[V]) Eq(v V) Condition {
+	return EqualsTo(c.name, v)
+}
+
+// Ne returns a Condition that is true when the column is not equal to v. See NotEqualsTo.
+func (c Col[V]) Ne(v V) Condition {
+	return NotEqualsTo(c.name, v)
+}
+
+// Lt returns a Condition that is true when the column is less than v. See LessThan.
+func (c Col[V]) Lt(v V) Condition {
+	return LessThan(c.name, v)
+}
+
+// Le returns a Condition that is true when the column is less than or equal to v. See
+// LessThanOrEqualTo.
+func (c Col[V]) Le(v V) Condition {
+	return LessThanOrEqualTo(c.name, v)
+}
+
+// Gt returns a Condition that is true when the column is greater than v. See GreaterThan.
+func (c Col[V]) Gt(v V) Condition {
+	return GreaterThan(c.name, v)
+}
+
+// Ge returns a Condition that is true when the column is greater than or equal to v. See
+// GreaterThanOrEqualTo.
+func (c Col[V]) Ge(v V) Condition {
+	return GreaterThanOrEqualTo(c.name, v)
+}
+
+// Between returns a Condition that is true when the column is between v1 and v2. See
+// Between.
+func (c Col[V]) Between(v1 V, v2 V) Condition {
+	return Between(c.name, v1, v2)
+}
+
+// In returns a Condition that is true when the column is in the values. See In.
+func (c Col[V]) In(values ...V) Condition {
+	return In(c.name, anys(values)...)
+}
+
+// NotIn returns a Condition that is true when the column is not in the values. See NotIn.
+func (c Col[V]) NotIn(values ...V) Condition {
+	return NotIn(c.name, anys(values)...)
+}
+
+// IsNull returns a Condition that is true when the column is null. See IsNull.
+func (c Col[V]) IsNull() Condition {
+	return IsNull(c.name)
+}
+
+// IsNotNull returns a Condition that is true when the column is not null. See IsNotNull.
+func (c Col[V]) IsNotNull() Condition {
+	return IsNotNull(c.name)
+}
+
+// IsDistinctFrom returns a Condition that is true when the column is distinct from v. See
+// IsDistinctFrom.
+func (c Col[V]) IsDistinctFrom(v V) Condition {
+	return IsDistinctFrom(c.name, v)
+}
+
+// IsNotDistinctFrom returns a Condition that is true when the column is not distinct from
+// v. See IsNotDistinctFrom.
+func (c Col[V]) IsNotDistinctFrom(v V) Condition {
+	return IsNotDistinctFrom(c.name, v)
+}
+
+// StringCol is a typed reference to a string column, which also has the conditions that
+// only apply to strings.
+type StringCol struct {
+	Col[string]
+}
+
+// NewStringCol returns a StringCol referring to the column with the given name.
+func NewStringCol(name string) StringCol {
+	return StringCol{Col: NewCol[string](name)}
+}
+
+// Like returns a Condition that is true when the column is LIKE the pattern. See Like.
+func (c StringCol) Like(pattern string) Condition {
+	return Like(c.name, pattern)
+}
+
+// ILike returns a Condition that is true when the column is LIKE the pattern, ignoring
+// case. See ILike.
+func (c StringCol) ILike(pattern string) Condition {
+	return ILike(c.name, pattern)
+}
+
+// StartsWith returns a Condition that is true when the column starts with the prefix. See
+// StartsWith.
+func (c StringCol) StartsWith(prefix string) Condition {
+	return StartsWith(c.name, prefix)
+}
+
+// SimilarTo returns a Condition that is true when the column matches the SQL regular
+// expression. See SimilarTo.
+func (c StringCol) SimilarTo(pattern string) Condition {
+	return SimilarTo(c.name, pattern)
+}
+
+// Matches returns a Condition that is true when the column matches the POSIX regular
+// expression. See Matches.
+func (c StringCol) Matches(pattern string) Condition {
+	return Matches(c.name, pattern)
+}
+
+// anys converts the values to a slice of any.
+func anys[V any](values []V) []any {
+	a := make([]any, len(values))
+	for i, v := range values {
+		a[i] = v
+	}
+	return a
+}
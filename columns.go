@@ -3,14 +3,20 @@ package sculpt
 import (
 	"fmt"
 	"reflect"
+	"strings"
+	"sync"
 
 	"github.com/tiredkangaroo/sculpt/internals/sql"
 )
 
-// registeredPrimaryKeys stores a map of model names to their primary key columns.
-// It is used in order to validate references to other models, ensuring the type of
-// the reference in Postgres and the existence of a primary key column in the Model.
-var registeredPrimaryKeys = make(map[string]Column) // model name: primary key column
+// registeredPrimaryKeys stores a map of models to their primary key columns, keyed by
+// modelKey. It is used in order to validate references to other models, ensuring the type
+// of the reference and the existence of a primary key column in the Model.
+var registeredPrimaryKeys = make(map[string]Column) // model key: primary key column
+
+// registryMu guards the registries of models, which are written by New and read by
+// concurrently made models.
+var registryMu sync.RWMutex
 
 // Column represents a column in a Sculpt model.
 type Column struct {
@@ -47,9 +53,29 @@ type Column struct {
 	// tag "autoincrement".
 	autoincrement bool
 
+	// defaultvalue is the SQL expression used as the default value of the column. This information is
+	// obtained from the struct tag "default". The column must be an Optional, and when saving, the default
+	// is used if the field is nil.
+	defaultvalue string
+
+	// references is the name of the model the column references. This information is obtained from the struct
+	// tag "references", which names a model in the same package, or a model in another package by its
+	// package-qualified name (such as "example.com/shop.Customer").
+	references string
+
+	// referencedModel is the modelKey of the model the column references. It is set by resolveReference.
+	referencedModel string
+
+	// referenced is the primary key column of the referenced model. It is set by resolveReference, once the
+	// model the column is on is known.
+	referenced *Column
+
 	// ondelete specifies the ON DELETE action for the column. This information is obtained from the struct tag "ondelete".
 	ondelete sql.OnDelete
 
+	// onupdate specifies the ON UPDATE action for the column. This information is obtained from the struct tag "onupdate".
+	onupdate sql.OnDelete
+
 	// validators is a map of validators for the column. The key is the validator, and the value is a slice of
 	// reflect.Values that represent the validator input. This information is obtained from the struct tag "validators".
 	validators map[*Validator][]reflect.Value
@@ -95,6 +121,28 @@ func handleColumn(f reflect.StructField) (Column, error) {
 		return c, err
 	}
 
+	// default
+	c.defaultvalue = f.Tag.Get("default")
+	if c.defaultvalue != "" && c.autoincrement {
+		return c, fmt.Errorf("cannot use a default on an autoincrement column")
+	}
+	if c.defaultvalue != "" && !c.nullable {
+		// a zero value could not be told apart from an unset field
+		return c, fmt.Errorf("cannot use a default on a column that is not an Optional")
+	}
+
+	// references, ondelete and onupdate
+	c.references = f.Tag.Get("references")
+	if c.ondelete, err = referentialAction(f.Tag.Get("ondelete"), c.references, c.nullable); err != nil {
+		return c, fmt.Errorf("ondelete: %v", err)
+	}
+	if c.onupdate, err = referentialAction(f.Tag.Get("onupdate"), c.references, c.nullable); err != nil {
+		return c, fmt.Errorf("onupdate: %v", err)
+	}
+	if c.references != "" && c.autoincrement {
+		return c, fmt.Errorf("cannot use references on an autoincrement column")
+	}
+
 	// validators
 	if c.validators, err = validatorsFromTag(f.Type, f.Tag.Get("validators")); err != nil {
 		return c, err
@@ -106,6 +154,139 @@ func handleColumn(f reflect.StructField) (Column, error) {
 	return c, nil
 }
 
+// referentialAction returns the ON DELETE or ON UPDATE action from its struct tag. It
+// defaults to NO ACTION, and can only be used on a column that references another model.
+// SET NULL can only be used on a nullable column.
+func referentialAction(tag string, references string, nullable bool) (sql.OnDelete, error) {
+	if tag == "" {
+		return sql.NOACTION, nil
+	}
+	if references == "" {
+		return sql.NOACTION, fmt.Errorf("can only be used with references")
+	}
+	action := sql.OnDeleteFromString(tag)
+	if action.String() != tag {
+		return sql.NOACTION, fmt.Errorf("unknown action %s", tag)
+	}
+	if action == sql.SETNULL && !nullable {
+		return sql.NOACTION, fmt.Errorf("SET NULL can only be used on a column that is an Optional")
+	}
+	return action, nil
+}
+
+// resolveReference sets the referenced primary key column of a column that references
+// another model, from registeredPrimaryKeys. The model being made has the struct type rt,
+// and its primary key is pk, so that a model can reference itself.
+func (c *Column) resolveReference(rt reflect.Type, pk *Column) error {
+	if c.references == "" {
+		return nil
+	}
+	key := rt.PkgPath() + "." + c.references
+	if i := strings.LastIndex(c.references, "."); i >= 0 {
+		key = c.references
+		c.references = c.references[i+1:]
+	}
+
+	var referenced Column
+	if key == modelKey(rt) && pk != nil {
+		referenced = *pk
+	} else {
+		var ok bool
+		registryMu.RLock()
+		referenced, ok = registeredPrimaryKeys[key]
+		registryMu.RUnlock()
+		if !ok {
+			return fmt.Errorf("referenced model %s does not exist or does not have a primary key; it must be made with New first", key)
+		}
+	}
+	if c.valueType() != referenced.valueType() {
+		return fmt.Errorf("type %s does not match the type %s of %s.%s", c.valueType(), referenced.valueType(), c.references, referenced.name)
+	}
+	c.referenced = &referenced
+	c.referencedModel = key
+	return nil
+}
+
+// modelKey returns the package-qualified name of the struct type of a model, so that models
+// with the same name in different packages are told apart.
+func modelKey(t reflect.Type) string {
+	return t.PkgPath() + "." + t.Name()
+}
+
+// valueType returns the Go type of the values of the column, which is the type argument of
+// an Optional column.
+func (c Column) valueType() reflect.Type {
+	if !c.nullable {
+		return c.t
+	}
+	valuemethod, _ := c.t.MethodByName("Value")
+	return valuemethod.Type.Out(0)
+}
+
+// usesDefault returns whether the column's value is given by the database when saving the
+// struct in rv, either because the column is autoincrement or because it has a default and
+// the field is a nil Optional.
+func (c Column) usesDefault(rv reflect.Value) bool {
+	if c.autoincrement {
+		return true
+	}
+	return c.defaultvalue != "" && c.fieldValue(rv) == nil
+}
+
+// value returns the value of the column's field in rv, the reflected value of a model's
+// struct, after validating it with the column's validators. See fieldValue for more
+// information on the value returned.
+func (c Column) value(rv reflect.Value) (any, error) {
+	value := c.fieldValue(rv)
+	if value == nil {
+		return nil, nil
+	}
+	for validator, rv := range c.validators {
+		if err := validator.Validate(value, rv...); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// fieldValue returns the value of the column's field in rv, the reflected value of a
+// model's struct. If the column is an Optional, the value it holds is returned, or nil
+// if the Optional is nil.
+func (c Column) fieldValue(rv reflect.Value) any {
+	field := rv.FieldByName(c.name)
+	if !c.nullable {
+		return field.Interface()
+	}
+
+	// call the Optional.Nil method
+	nilcheck := field.MethodByName("Nil").Call([]reflect.Value{})
+	if nilcheck[0].Bool() { // if the optional is nil
+		return nil
+	}
+	v := field.MethodByName("Value").Call([]reflect.Value{}) // call the Optional.Value method
+	return v[0].Interface()
+}
+
+// columnByName returns the column in columns with the given name.
+func columnByName(columns []Column, name string) (Column, bool) {
+	for _, column := range columns {
+		if column.name == name {
+			return column, true
+		}
+	}
+	return Column{}, false
+}
+
+// scanTargets returns pointers to the fields of the columns in rv, the addressable reflected
+// value of a model's struct, so that they can be scanned into by pgx.
+func scanTargets(rv reflect.Value, columns []Column) []any {
+	targets := make([]any, len(columns))
+	for i, column := range columns {
+		targets[i] = rv.FieldByName(column.name).Addr().Interface()
+	}
+	return targets
+}
+
 // boolFromString converts a string to a boolean.
 func boolFromString(s string) (bool, error) {
 	switch s {
@@ -2,23 +2,40 @@ package sculpt
 
 import (
 	"fmt"
+	"strings"
 )
 
 // Condition represents a condition that can be used in a query.
+//
+// A Condition refers to columns by name, rather than holding raw SQL, so that the
+// columns can be checked against the model and quoted when the query is compiled.
 type Condition struct {
-	s string
+	// columns is the names of the columns the condition is on.
+	columns []string
+
+	// format is the SQL of the condition, where each %s is replaced by a quoted column
+	// from columns, in order.
+	format string
+
+	// a is the arguments to the placeholders in format.
 	a []any
+
+	// operator combines the conditions in children with AND, OR or NOT. If it is set,
+	// columns, format and a are not used.
+	operator string
+	children []Condition
 }
 
 // EqualsTo returns a Condition that is true when the value of the column
 // is equal to the given value.
 func EqualsTo(name string, v any) Condition {
 	c := Condition{
+		columns: []string{name},
 		// <_sculpt> keeps a placeholder in order to replace instances
 		// of the substring with an integer, that then gets replaced
 		// by pgx with v
-		s: fmt.Sprintf("%s = $<_sculpt>", name),
-		a: []any{v},
+		format: "%s = $<_sculpt>",
+		a:      []any{v},
 	}
 	return c
 }
@@ -27,8 +44,9 @@ func EqualsTo(name string, v any) Condition {
 // is less than the given value.
 func LessThan(name string, v any) Condition {
 	c := Condition{
-		s: fmt.Sprintf("%s < $<_sculpt>", name),
-		a: []any{v},
+		columns: []string{name},
+		format:  "%s < $<_sculpt>",
+		a:       []any{v},
 	}
 	return c
 }
@@ -37,8 +55,9 @@ func LessThan(name string, v any) Condition {
 // is less than or equal to the given value.
 func LessThanOrEqualTo(name string, v any) Condition {
 	c := Condition{
-		s: fmt.Sprintf("%s <= $<_sculpt>", name),
-		a: []any{v},
+		columns: []string{name},
+		format:  "%s <= $<_sculpt>",
+		a:       []any{v},
 	}
 	return c
 }
@@ -47,8 +66,9 @@ func LessThanOrEqualTo(name string, v any) Condition {
 // is greater than the given value.
 func GreaterThan(name string, v any) Condition {
 	c := Condition{
-		s: fmt.Sprintf("%s > $<_sculpt>", name),
-		a: []any{v},
+		columns: []string{name},
+		format:  "%s > $<_sculpt>",
+		a:       []any{v},
 	}
 	return c
 }
@@ -57,8 +77,9 @@ func GreaterThan(name string, v any) Condition {
 // is greater than or equal to the given value.
 func GreaterThanOrEqualTo(name string, v any) Condition {
 	c := Condition{
-		s: fmt.Sprintf("%s >= $<_sculpt>", name),
-		a: []any{v},
+		columns: []string{name},
+		format:  "%s >= $<_sculpt>",
+		a:       []any{v},
 	}
 	return c
 }
@@ -67,8 +88,9 @@ func GreaterThanOrEqualTo(name string, v any) Condition {
 // is not equal to the given value.
 func NotEqualsTo(name string, v any) Condition {
 	c := Condition{
-		s: fmt.Sprintf("%s <> $<_sculpt>", name),
-		a: []any{v},
+		columns: []string{name},
+		format:  "%s <> $<_sculpt>",
+		a:       []any{v},
 	}
 	return c
 }
@@ -77,8 +99,9 @@ func NotEqualsTo(name string, v any) Condition {
 // is LIKE the given value.
 func Like(name string, v any) Condition {
 	c := Condition{
-		s: fmt.Sprintf("%s LIKE $<_sculpt>", name),
-		a: []any{v},
+		columns: []string{name},
+		format:  "%s LIKE $<_sculpt>",
+		a:       []any{v},
 	}
 	return c
 }
@@ -87,43 +110,207 @@ func Like(name string, v any) Condition {
 // is between the two given values.
 func Between(name string, v1 any, v2 any) Condition {
 	c := Condition{
-		s: fmt.Sprintf("%s BETWEEN $<_sculpt> AND $<_sculpt>", name),
-		a: []any{v1, v2},
+		columns: []string{name},
+		format:  "%s BETWEEN $<_sculpt> AND $<_sculpt>",
+		a:       []any{v1, v2},
 	}
 	return c
 }
 
 // In returns a Condition that is true when the value of the column
-// is in the given values.
+// is in the given values. With no values, it is always false.
 func In(name string, values ...any) Condition {
-	c := Condition{
-		s: fmt.Sprintf("%s IN (", name),
+	if len(values) == 0 {
+		return Condition{format: "FALSE"}
 	}
+	return list(name, "%s IN (", values)
+}
+
+// NotIn returns a Condition that is true when the value of the column
+// is not in the given values. With no values, it is always true.
+func NotIn(name string, values ...any) Condition {
+	if len(values) == 0 {
+		return Condition{format: "TRUE"}
+	}
+	return list(name, "%s NOT IN (", values)
+}
+
+// list returns a Condition on the column that starts with format and is
+// followed by a placeholder for each value, in parentheses.
+func list(name string, format string, values []any) Condition {
+	c := Condition{columns: []string{name}, format: format}
 	for i, v := range values {
-		c.s += "$<_sculpt>"
+		c.format += "$<_sculpt>"
 		if i < len(values)-1 {
-			c.s += ", "
+			c.format += ", "
 		}
 		c.a = append(c.a, v)
 	}
-	c.s += ")"
+	c.format += ")"
 	return c
 }
 
-// Or returns a Condition that is the result of combining two Conditions where either
-// of the two must be true for the combined Condition to be true.
-func Or(c1 Condition, c2 Condition) Condition {
+// IsNull returns a Condition that is true when the value of the column
+// is null, such as a nil Optional.
+func IsNull(name string) Condition {
+	return Condition{
+		columns: []string{name},
+		format:  "%s IS NULL",
+	}
+}
+
+// IsNotNull returns a Condition that is true when the value of the column
+// is not null.
+func IsNotNull(name string) Condition {
+	return Condition{
+		columns: []string{name},
+		format:  "%s IS NOT NULL",
+	}
+}
+
+// ILike returns a Condition that is true when the value of the column
+// is LIKE the given value, ignoring case.
+func ILike(name string, v any) Condition {
+	c := Condition{
+		columns: []string{name},
+		format:  "%s ILIKE $<_sculpt>",
+		a:       []any{v},
+	}
+	return c
+}
+
+// likeEscaper escapes the characters that have a special meaning in a
+// LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// StartsWith returns a Condition that is true when the value of the column
+// starts with the given prefix. Unlike Like, the prefix is matched literally.
+func StartsWith(name string, prefix string) Condition {
 	c := Condition{
-		s: fmt.Sprintf("%s OR %s", c1.s, c2.s),
-		a: append(c1.a, c2.a...),
+		columns: []string{name},
+		format:  "%s LIKE $<_sculpt>",
+		a:       []any{likeEscaper.Replace(prefix) + "%"},
 	}
 	return c
 }
 
+// SimilarTo returns a Condition that is true when the value of the column
+// matches the given SQL regular expression, using SIMILAR TO.
+func SimilarTo(name string, v any) Condition {
+	c := Condition{
+		columns: []string{name},
+		format:  "%s SIMILAR TO $<_sculpt>",
+		a:       []any{v},
+	}
+	return c
+}
+
+// Matches returns a Condition that is true when the value of the column
+// matches the given POSIX regular expression, using the ~ operator.
+func Matches(name string, v any) Condition {
+	c := Condition{
+		columns: []string{name},
+		format:  "%s ~ $<_sculpt>",
+		a:       []any{v},
+	}
+	return c
+}
+
+// IsDistinctFrom returns a Condition that is true when the value of the
+// column is not equal to the given value, treating null as a comparable
+// value. Unlike NotEqualsTo, it is true when only one of the values is null.
+func IsDistinctFrom(name string, v any) Condition {
+	c := Condition{
+		columns: []string{name},
+		format:  "%s IS DISTINCT FROM $<_sculpt>",
+		a:       []any{v},
+	}
+	return c
+}
+
+// IsNotDistinctFrom returns a Condition that is true when the value of the
+// column is equal to the given value, treating null as a comparable value.
+// Unlike EqualsTo, it is true when both of the values are null.
+func IsNotDistinctFrom(name string, v any) Condition {
+	c := Condition{
+		columns: []string{name},
+		format:  "%s IS NOT DISTINCT FROM $<_sculpt>",
+		a:       []any{v},
+	}
+	return c
+}
+
+// And returns a Condition that is true when all of the given Conditions are true. The
+// combined Condition is parenthesized, so that it can be safely combined with others. With
+// no Conditions, it is always true.
+func And(c ...Condition) Condition {
+	return combine("AND", "TRUE", c)
+}
+
+// Or returns a Condition that is true when any of the given Conditions are true. The
+// combined Condition is parenthesized, so that it can be safely combined with others. With
+// no Conditions, it is always false.
+func Or(c ...Condition) Condition {
+	return combine("OR", "FALSE", c)
+}
+
 // Not returns a Condition whose results is opposite that of the given Condition.
 func Not(c Condition) Condition {
 	return Condition{
-		s: fmt.Sprintf("NOT %s", c.s),
-		a: c.a,
+		operator: "NOT",
+		children: []Condition{c},
+	}
+}
+
+// combine combines the Conditions with the operator. If there are no Conditions,
+// the empty value is used.
+func combine(operator string, empty string, conditions []Condition) Condition {
+	if len(conditions) == 0 {
+		return Condition{format: empty}
+	}
+	return Condition{
+		operator: operator,
+		children: conditions,
+	}
+}
+
+// resolver resolves the name of a column given to a Condition to the SQL that refers
+// to it, returning an error if there is no such column.
+type resolver func(name string) (string, error)
+
+// compile makes the SQL of the Condition, and returns it with the pgx arguments for it.
+// Columns are resolved with resolve, and placeholders are numbered starting after j, which
+// is left at the number of the last placeholder used, as with every compile function taking
+// j. Combined Conditions are parenthesized, so that they can be safely combined with others.
+func (c Condition) compile(resolve resolver, j *int) (string, []any, error) {
+	if c.operator != "" {
+		parts := make([]string, len(c.children))
+		a := []any{}
+		for i, child := range c.children {
+			s, ca, err := child.compile(resolve, j)
+			if err != nil {
+				return "", nil, err
+			}
+			parts[i] = s
+			a = append(a, ca...)
+		}
+		if c.operator == "NOT" {
+			return fmt.Sprintf("NOT (%s)", parts[0]), a, nil
+		}
+		return "(" + strings.Join(parts, fmt.Sprintf(" %s ", c.operator)) + ")", a, nil
+	}
+
+	columns := make([]any, len(c.columns))
+	for i, name := range c.columns {
+		column, err := resolve(name)
+		if err != nil {
+			return "", nil, fmt.Errorf("condition on %s: %w", name, err)
+		}
+		columns[i] = column
 	}
+	s := replaceAllFunc(fmt.Sprintf(c.format, columns...), "<_sculpt>", func() string {
+		*j++
+		return fmt.Sprintf("%d", *j)
+	})
+	return s, c.a, nil
 }
@@ -0,0 +1,121 @@
+package sculpt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type conditionUser struct {
+	ID    int `pk:"true" autoincrement:"true"`
+	Name  string
+	Age   int
+	Email Optional[string]
+}
+
+func conditionUserModel(t *testing.T) *Model[conditionUser] {
+	t.Helper()
+	m, err := New[conditionUser]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestConditionCompile(t *testing.T) {
+	resolve := conditionUserModel(t).Query().resolve
+
+	tests := []struct {
+		name string
+		c    Condition
+		want string
+		a    []any
+	}{
+		{"equals", EqualsTo("Name", "a"), `"name" = $1`, []any{"a"}},
+		{"between", Between("Age", 1, 2), `"age" BETWEEN $1 AND $2`, []any{1, 2}},
+		{"in", In("ID", 1, 2, 3), `"id" IN ($1, $2, $3)`, []any{1, 2, 3}},
+		{"in without values", In("ID"), `FALSE`, nil},
+		{"not in without values", NotIn("ID"), `TRUE`, nil},
+		{"is null", IsNull("Email"), `"email" IS NULL`, nil},
+		{"starts with", StartsWith("Name", `50%_a\`), `"name" LIKE $1`, []any{`50\%\_a\\%`}},
+		{"is distinct from", IsDistinctFrom("Email", "a"), `"email" IS DISTINCT FROM $1`, []any{"a"}},
+		{"and without conditions", And(), `TRUE`, nil},
+		{"or without conditions", Or(), `FALSE`, nil},
+		{
+			name: "nested",
+			c: Or(
+				And(EqualsTo("Name", "a"), Between("Age", 1, 2)),
+				Not(Or(In("ID", 3, 4), LessThan("Age", 5))),
+				GreaterThan("Age", 6),
+			),
+			want: `(("name" = $1 AND "age" BETWEEN $2 AND $3) OR NOT (("id" IN ($4, $5) OR "age" < $6)) OR "age" > $7)`,
+			a:    []any{"a", 1, 2, 3, 4, 5, 6},
+		},
+		{
+			name: "nested with empty in",
+			c:    And(EqualsTo("Name", "a"), In("ID"), EqualsTo("Age", 1)),
+			want: `("name" = $1 AND FALSE AND "age" = $2)`,
+			a:    []any{"a", 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := 0
+			s, a, err := tt.c.compile(resolve, &j)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != tt.want {
+				t.Errorf("condition = %s, want %s", s, tt.want)
+			}
+			if len(a) != len(tt.a) || (len(a) > 0 && !reflect.DeepEqual(a, tt.a)) {
+				t.Errorf("arguments = %v, want %v", a, tt.a)
+			}
+			if j != len(tt.a) {
+				t.Errorf("last placeholder = %d, want %d", j, len(tt.a))
+			}
+		})
+	}
+}
+
+func TestConditionCompileContinuesNumbering(t *testing.T) {
+	resolve := conditionUserModel(t).Query().resolve
+	j := 2
+	s, _, err := And(EqualsTo("Name", "a"), EqualsTo("Age", 1)).compile(resolve, &j)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `("name" = $3 AND "age" = $4)`; s != want {
+		t.Errorf("condition = %s, want %s", s, want)
+	}
+	if j != 4 {
+		t.Errorf("last placeholder = %d, want 4", j)
+	}
+}
+
+func TestConditionCompileUnknownColumn(t *testing.T) {
+	resolve := conditionUserModel(t).Query().resolve
+	tests := []Condition{
+		EqualsTo("Nope", 1),
+		And(EqualsTo("Name", "a"), Or(IsNull("Nope"))),
+		Not(EqualsTo(`name" = '' OR 1=1 --`, 1)),
+	}
+	for _, c := range tests {
+		j := 0
+		if _, _, err := c.compile(resolve, &j); err == nil {
+			t.Errorf("condition on an unknown column returned no error")
+		}
+	}
+}
+
+func TestConditionCompileResolverError(t *testing.T) {
+	errResolve := errors.New("resolve")
+	resolve := func(string) (string, error) {
+		return "", errResolve
+	}
+	j := 0
+	_, _, err := EqualsTo("Name", "a").compile(resolve, &j)
+	if !errors.Is(err, errResolve) {
+		t.Errorf("err = %v, want it to wrap %v", err, errResolve)
+	}
+}
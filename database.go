@@ -2,23 +2,131 @@ package sculpt
 
 import (
 	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
 
-	"github.com/tiredkangaroo/sculpt/internals/sql"
-
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// Connect connects to the Postgres database using the given URL.
+// PoolConfig configures the connection pool used to talk to Postgres. A zero value
+// for any field leaves the pgxpool default in place.
+type PoolConfig struct {
+	// MinConns is the minimum number of connections kept open by the pool.
+	MinConns int32
+
+	// MaxConns is the maximum number of connections the pool will open.
+	MaxConns int32
+
+	// MaxConnLifetime is how long a connection may exist before it is closed and replaced.
+	MaxConnLifetime time.Duration
+
+	// MaxConnIdleTime is how long a connection may sit idle before it is closed.
+	MaxConnIdleTime time.Duration
+
+	// HealthCheckPeriod is how often idle connections are checked for health.
+	HealthCheckPeriod time.Duration
+}
+
+// apply sets the non-zero fields of the PoolConfig on the pgxpool configuration.
+func (c PoolConfig) apply(config *pgxpool.Config) {
+	if c.MinConns != 0 {
+		config.MinConns = c.MinConns
+	}
+	if c.MaxConns != 0 {
+		config.MaxConns = c.MaxConns
+	}
+	if c.MaxConnLifetime != 0 {
+		config.MaxConnLifetime = c.MaxConnLifetime
+	}
+	if c.MaxConnIdleTime != 0 {
+		config.MaxConnIdleTime = c.MaxConnIdleTime
+	}
+	if c.HealthCheckPeriod != 0 {
+		config.HealthCheckPeriod = c.HealthCheckPeriod
+	}
+}
+
+// DB is a handle to a Postgres database. It is backed by a connection pool, so it
+// is safe for concurrent use. Models are bound to a DB with Model.WithDB; models that
+// are not bound to one use the default DB, set with Connect.
+type DB struct {
+	pool *pgxpool.Pool
+}
+
+// defaultDB is the DB used by models that are not bound to a DB. It is set by Connect
+// and ConnectPool, and is nil until then.
+var defaultDB atomic.Pointer[DB]
+
+// Open opens a new DB to the Postgres database using the given URL, with the default pool
+// configuration.
+func Open(postgresURL string) (*DB, error) {
+	return OpenPool(postgresURL, PoolConfig{})
+}
+
+// OpenPool opens a new DB to the Postgres database using the given URL and pool
+// configuration. Each database operation acquires a connection from the pool and
+// releases it once finished.
+func OpenPool(postgresURL string, poolConfig PoolConfig) (*DB, error) {
+	config, err := pgxpool.ParseConfig(postgresURL)
+	if err != nil {
+		return nil, err
+	}
+	poolConfig.apply(config)
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(context.Background()); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &DB{pool: pool}, nil
+}
+
+// Close closes the DB's connection pool, waiting for acquired connections to be released.
+func (db *DB) Close() {
+	db.pool.Close()
+}
+
+// Connect connects the default DB to the Postgres database using the given URL, with
+// the default pool configuration.
 func Connect(postgresURL string) error {
-	conn, err := pgx.Connect(context.Background(), postgresURL)
+	return ConnectPool(postgresURL, PoolConfig{})
+}
+
+// ConnectPool connects the default DB to the Postgres database using the given URL and
+// pool configuration. An error is returned if the default DB is already connected; it
+// must be closed with Close first.
+func ConnectPool(postgresURL string, poolConfig PoolConfig) error {
+	if defaultDB.Load() != nil {
+		return fmt.Errorf("the default DB is already connected")
+	}
+	db, err := OpenPool(postgresURL, poolConfig)
 	if err != nil {
 		return err
 	}
-	sql.SetActiveDB(conn)
+	if !defaultDB.CompareAndSwap(nil, db) {
+		// connected concurrently by another call
+		db.Close()
+		return fmt.Errorf("the default DB is already connected")
+	}
 	return nil
 }
 
-// Close closes the active database connection, previously started with Connect.
+// Default returns the default DB, previously connected with Connect or ConnectPool. It
+// returns nil if the default DB is not connected.
+func Default() *DB {
+	return defaultDB.Load()
+}
+
+// Close closes the default DB, previously connected with Connect or ConnectPool.
 func Close() error {
-	return sql.CloseActiveDB()
+	db := defaultDB.Swap(nil)
+	if db == nil {
+		return ErrNoDatabase
+	}
+	db.Close()
+	return nil
 }
@@ -0,0 +1,18 @@
+package sculpt
+
+import "errors"
+
+// ErrNoDatabase is returned when an operation is attempted on a model that is not bound
+// to a DB while no default DB has been connected.
+var ErrNoDatabase = errors.New("no database connected, use Connect or Model.WithDB")
+
+// ErrNotFound is returned when an operation expects a row that does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrNoPrimaryKey is returned when an operation that requires a primary key is used on
+// a model without one.
+var ErrNoPrimaryKey = errors.New("model does not have a primary key")
+
+// ErrMultipleResults is returned when an operation expects one result, but more than one
+// row meets the conditions.
+var ErrMultipleResults = errors.New("multiple results")
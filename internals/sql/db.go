@@ -3,32 +3,74 @@ package sql
 import (
 	"context"
 	"log/slog"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
-var activeDB *pgx.Conn
 var Logger = slog.Default()
 
 func init() {
 	slog.SetLogLoggerLevel(slog.LevelDebug)
 }
 
-func SetActiveDB(db *pgx.Conn) {
-	activeDB = db
+// Executor is something statements can be run on. It is implemented by
+// *pgxpool.Pool, which acquires a connection for each call and releases it
+// once the call is finished, and by pgx.Tx. Begin starts a transaction on a
+// pool, and a savepoint in a transaction.
+type Executor interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
 }
 
-func CloseActiveDB() error {
-	return activeDB.Close(context.Background())
+// Execute executes the statement using the executor.
+func Execute(ctx context.Context, e Executor, statement string, a ...any) (pgconn.CommandTag, error) {
+	Logger.DebugContext(ctx, "executing", "statement", statement, "args", a)
+	return e.Exec(ctx, statement, a...)
 }
 
-func Execute(statement string, a ...any) (pgconn.CommandTag, error) {
-	Logger.Debug("executing", "statement", statement, "args", a)
-	return activeDB.Exec(context.Background(), statement, a...)
+// Query runs the statement using the executor. When the executor is a pool, the
+// connection is released back to the pool when the returned rows are closed.
+func Query(ctx context.Context, e Executor, statement string, a ...any) (pgx.Rows, error) {
+	Logger.DebugContext(ctx, "querying", "statement", statement, "args", a)
+	return e.Query(ctx, statement, a...)
 }
 
-func Query(statement string, a ...any) (pgx.Rows, error) {
-	Logger.Debug("querying", "statement", statement, "args", a)
-	return activeDB.Query(context.Background(), statement, a...)
+// SendBatch sends every statement queued in the batch to Postgres in one round trip. The
+// results must be read in the order the statements were queued, and then closed.
+func SendBatch(ctx context.Context, e Executor, b *pgx.Batch) pgx.BatchResults {
+	for _, q := range b.QueuedQueries {
+		Logger.DebugContext(ctx, "batching", "statement", q.SQL, "args", q.Arguments)
+	}
+	return e.SendBatch(ctx, b)
+}
+
+// Identifier quotes the name of a table or column so that it can be safely used in a
+// statement. The name is lowered first, matching the name Postgres gives to tables and
+// columns created with unquoted names. Given more than one part, such as a table and one
+// of its columns, the quoted parts are joined with a dot.
+func Identifier(parts ...string) string {
+	identifier := make(pgx.Identifier, len(parts))
+	for i, part := range parts {
+		identifier[i] = strings.ToLower(part)
+	}
+	return identifier.Sanitize()
+}
+
+// CopyFrom copies the rows into the table using the Postgres COPY protocol, and returns
+// the number of rows copied.
+//
+// The table and column names are quoted by pgx, and so they are lowered here to match
+// Identifier.
+func CopyFrom(ctx context.Context, e Executor, table string, columns []string, rows [][]any) (int64, error) {
+	Logger.DebugContext(ctx, "copying", "table", table, "columns", columns, "rows", len(rows))
+	lowered := make([]string, len(columns))
+	for i, column := range columns {
+		lowered[i] = strings.ToLower(column)
+	}
+	return e.CopyFrom(ctx, pgx.Identifier{strings.ToLower(table)}, lowered, pgx.CopyFromRows(rows))
 }
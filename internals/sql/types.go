@@ -76,6 +76,21 @@ func (t Type) String() string {
 	}
 }
 
+// NonSerial returns the integer type that a serial type is based on, which is the type
+// used by columns that reference it. Other types are returned unchanged.
+func (t Type) NonSerial() Type {
+	switch t {
+	case SmallSerialType:
+		return SmallintType
+	case SerialType:
+		return IntegerType
+	case BigSerialType:
+		return BigintType
+	default:
+		return t
+	}
+}
+
 // ReflectType returns a reflect.Type that corresponds to the SQL type. It is
 // a reverse of TypeFromReflectType. If the type is invalid, it returns nil.
 func (t Type) ReflectType() reflect.Type {
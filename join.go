@@ -0,0 +1,174 @@
+package sculpt
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/tiredkangaroo/sculpt/internals/sql"
+)
+
+// Table is a model that a query can be joined with, see Query.Join. It is implemented by
+// *Model.
+type Table interface {
+	table() table
+}
+
+// table is a model as a table of a query.
+type table struct {
+	name    string
+	t       reflect.Type
+	columns []Column
+}
+
+// table returns the model as a table of a query.
+func (m *Model[T]) table() table {
+	return table{name: m.name, t: m.t, columns: m.columns}
+}
+
+// join is a model joined with a query.
+type join struct {
+	table
+
+	// kind is the kind of join, such as INNER JOIN.
+	kind string
+
+	// on is the SQL condition the rows are joined on.
+	on string
+}
+
+// Join joins the query with the model t, on the rows where the column left equals the
+// column right of t. It is the same as InnerJoin.
+//
+// left is a column of the query's model, or a column of a model joined before, qualified
+// with the name of the model as in Customer.ID. Once a query has joins, its conditions can
+// also use qualified columns of the joined models. The results are still those of the
+// query's model; use Select to scan the joined models into a composite struct.
+//
+//	orders, err := orderModel.Query().
+//		Join(customerModel, "CustomerID", "ID").
+//		Conditions(sculpt.EqualsTo("Customer.Country", "NZ")).
+//		Do()
+//
+// An error is returned when the query is done if a column does not exist, or if the model
+// is already in the query.
+func (q *Query[T]) Join(t Table, left string, right string) *Query[T] {
+	return q.join("INNER JOIN", t, left, right)
+}
+
+// InnerJoin joins the query with the model t, only keeping the rows of the query that have
+// a row of t where the column left equals the column right of t. See Join for more
+// information.
+func (q *Query[T]) InnerJoin(t Table, left string, right string) *Query[T] {
+	return q.join("INNER JOIN", t, left, right)
+}
+
+// LeftJoin joins the query with the model t, like InnerJoin, but also keeps the rows of the
+// query that do not have a row of t. The columns of t are null in those rows, and so the
+// model should be scanned into a pointer field by Select. See Join for more information.
+func (q *Query[T]) LeftJoin(t Table, left string, right string) *Query[T] {
+	return q.join("LEFT JOIN", t, left, right)
+}
+
+// join joins the query with the model t, using the given kind of join.
+func (q *Query[T]) join(kind string, t Table, left string, right string) *Query[T] {
+	j := join{table: t.table(), kind: kind}
+	if j.name == q.model.name || q.joined(j.name) != nil {
+		q.err = fmt.Errorf("cannot join %s: model is already in the query", j.name)
+		return q
+	}
+
+	leftModel, leftColumn, err := q.lookup(left)
+	if err != nil {
+		q.err = fmt.Errorf("cannot join %s on %s: %v", j.name, left, err)
+		return q
+	}
+	if model, column, ok := strings.Cut(right, "."); ok && model == j.name {
+		right = column
+	}
+	rightColumn, ok := columnByName(j.columns, right)
+	if !ok {
+		q.err = fmt.Errorf("cannot join %s on %s: field is not on the model %s", j.name, right, j.name)
+		return q
+	}
+	if leftColumn.sqltype.NonSerial() != rightColumn.sqltype.NonSerial() {
+		q.err = fmt.Errorf("cannot join %s: type %s of %s does not match the type %s of %s",
+			j.name, leftColumn.sqltype.NonSerial(), left, rightColumn.sqltype.NonSerial(), right)
+		return q
+	}
+
+	// the columns of the condition are always qualified, since the models may share names
+	j.on = fmt.Sprintf("%s = %s", sql.Identifier(leftModel, leftColumn.name), sql.Identifier(j.name, rightColumn.name))
+	q.joins = append(q.joins, j)
+	return q
+}
+
+// joined returns the model joined with the query with the given name, or nil if there
+// is none.
+func (q *Query[T]) joined(name string) *join {
+	for i := range q.joins {
+		if q.joins[i].name == name {
+			return &q.joins[i]
+		}
+	}
+	return nil
+}
+
+// lookup returns the name of the model and the column that a name given to the query
+// refers to. The name is either a column of the query's model, or a column qualified with
+// the name of the query's model or of a joined model, as in Customer.Name.
+func (q *Query[T]) lookup(name string) (string, Column, error) {
+	model, field, qualified := strings.Cut(name, ".")
+	if !qualified {
+		model, field = q.model.name, name
+	}
+	if model == q.model.name {
+		column, ok := q.model.column(field)
+		if !ok {
+			return "", Column{}, fmt.Errorf("field is not on the model %s", q.model.name)
+		}
+		return q.model.name, column, nil
+	}
+
+	j := q.joined(model)
+	if j == nil {
+		return "", Column{}, fmt.Errorf("model %s is not joined with the query", model)
+	}
+	column, ok := columnByName(j.columns, field)
+	if !ok {
+		return "", Column{}, fmt.Errorf("field is not on the model %s", model)
+	}
+	return model, column, nil
+}
+
+// identifier returns the quoted column of the model. If the query has joins, the column
+// is qualified with the name of the model.
+func (q *Query[T]) identifier(model string, column string) string {
+	if len(q.joins) == 0 {
+		return sql.Identifier(column)
+	}
+	return sql.Identifier(model, column)
+}
+
+// from returns the FROM clause of the query, including its joins.
+func (q *Query[T]) from() string {
+	from := "FROM " + sql.Identifier(q.model.name)
+	for _, j := range q.joins {
+		from += fmt.Sprintf(" %s %s ON %s", j.kind, sql.Identifier(j.name), j.on)
+	}
+	return from
+}
+
+// tableOf returns the table of the query, either the query's model or a joined model, whose
+// struct type is t.
+func (q *Query[T]) tableOf(t reflect.Type) (table, bool) {
+	if t == q.model.t {
+		return q.model.table(), true
+	}
+	for _, j := range q.joins {
+		if j.t == t {
+			return j.table, true
+		}
+	}
+	return table{}, false
+}
@@ -1,10 +1,14 @@
 package sculpt
 
 import (
+	"context"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/tiredkangaroo/sculpt/internals/sql"
+
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 // Model represents a table in the database.
@@ -12,6 +16,47 @@ type Model[T any] struct {
 	name    string
 	t       reflect.Type
 	columns []Column
+
+	// relations are the fields of the model holding related models, see Query.Preload.
+	relations []relation
+
+	// db is the DB the model is bound to. If it is nil, the default DB is used.
+	db *DB
+
+	// tx is the transaction the model is bound to. If it is not nil, it takes
+	// precedence over db.
+	tx *Tx
+}
+
+// WithDB returns a copy of the model that is bound to the given DB, instead of the
+// default DB.
+func (m *Model[T]) WithDB(db *DB) *Model[T] {
+	bound := *m
+	bound.db = db
+	return &bound
+}
+
+// In returns a copy of the model that is bound to the given transaction. Statements
+// made with the copy, including those of its queries, are run inside of the transaction.
+func (m *Model[T]) In(tx *Tx) *Model[T] {
+	bound := *m
+	bound.tx = tx
+	return &bound
+}
+
+// executor returns the executor that the model's statements should be run on.
+func (m *Model[T]) executor() (sql.Executor, error) {
+	if m.tx != nil {
+		return m.tx.tx, nil
+	}
+	db := m.db
+	if db == nil {
+		db = defaultDB.Load()
+	}
+	if db == nil {
+		return nil, ErrNoDatabase
+	}
+	return db.pool, nil
 }
 
 // Query creates a new Query to get stored data with the model.
@@ -19,81 +64,423 @@ func (m *Model[T]) Query() *Query[T] {
 	return &Query[T]{model: m}
 }
 
+// Get returns the stored struct whose primary key is pk. ErrNotFound is returned if there
+// is none, and ErrNoPrimaryKey is returned if the model does not have a primary key.
+func (m *Model[T]) Get(pk any) (T, error) {
+	return m.GetContext(context.Background(), pk)
+}
+
+// GetContext is like Get, but uses the given context for the query.
+func (m *Model[T]) GetContext(ctx context.Context, pk any) (T, error) {
+	column, err := m.primaryKey()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return m.Query().Conditions(EqualsTo(column.name, pk)).FirstContext(ctx)
+}
+
 // Save uses the Postgres connection to save the struct into to the database table.
 func (m *Model[T]) Save(v T) error {
-	statement := fmt.Sprintf(`INSERT INTO %s (`, m.name)
+	return m.SaveContext(context.Background(), v)
+}
+
+// SaveContext is like Save, but uses the given context for the statement.
+func (m *Model[T]) SaveContext(ctx context.Context, v T) error {
+	statement, values, _, err := m.compileSave(reflect.ValueOf(v), false)
+	if err != nil {
+		return err
+	}
+
+	e, err := m.executor()
+	if err != nil {
+		return err
+	}
+	_, err = sql.Execute(ctx, e, statement, values...)
+	return err
+}
+
+// SaveReturning is like Save, but the values given by the database to autoincrement
+// columns, and to columns whose default was used, are set on the struct v points to.
+func (m *Model[T]) SaveReturning(v *T) error {
+	return m.SaveReturningContext(context.Background(), v)
+}
+
+// SaveReturningContext is like SaveReturning, but uses the given context for the statement.
+func (m *Model[T]) SaveReturningContext(ctx context.Context, v *T) error {
+	rv := reflect.ValueOf(v).Elem()
+	statement, values, returning, err := m.compileSave(rv, true)
+	if err != nil {
+		return err
+	}
+
+	e, err := m.executor()
+	if err != nil {
+		return err
+	}
+	rows, err := sql.Query(ctx, e, statement, values...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if len(returning) > 0 && rows.Next() {
+		if err := rows.Scan(scanTargets(rv, returning)...); err != nil {
+			return err
+		}
+	}
+	rows.Close()
+	return rows.Err()
+}
+
+// compileSave makes an INSERT statement for the struct in rv, and returns it with the pgx
+// arguments for it. If returning is true, the statement returns the columns whose value
+// is given by the database, which are also returned in order.
+func (m *Model[T]) compileSave(rv reflect.Value, returning bool) (string, []any, []Column, error) {
+	statement, values, defaulted, err := m.compileInsert(rv, "")
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if returning && len(defaulted) > 0 {
+		names := make([]string, len(defaulted))
+		for i, column := range defaulted {
+			names[i] = sql.Identifier(column.name)
+		}
+		statement += ` RETURNING ` + strings.Join(names, `, `)
+	} else {
+		defaulted = nil
+	}
+	statement += `;`
+	return statement, values, defaulted, nil
+}
+
+// compileInsert makes the INSERT INTO ... VALUES (...) part of a statement for the struct
+// in rv, and returns it with the pgx arguments for it and the columns whose value is given
+// by the database. The values are validated with the column validators.
+//
+// bound is the name of an autoincrement column whose field is used, rather than the value
+// given by the database, when it is not a zero value. It is empty for none.
+func (m *Model[T]) compileInsert(rv reflect.Value, bound string) (string, []any, []Column, error) {
+	statement := fmt.Sprintf(`INSERT INTO %s (`, sql.Identifier(m.name))
 	values_statement := `VALUES (`
 	values := []any{}
+	defaulted := []Column{}
 
-	rv := reflect.ValueOf(v)
 	i := 0 // i maintains a counter of placeholder usage for pgx
 	for j, column := range m.columns {
-		statement += column.name
-		if column.autoincrement {
+		statement += sql.Identifier(column.name)
+		if j > 0 {
+			values_statement += `, `
+		}
+		if j < len(m.columns)-1 {
+			statement += `, `
+		}
+		if column.usesDefault(rv) && !(column.name == bound && !rv.FieldByName(bound).IsZero()) {
 			values_statement += `DEFAULT`
-			if j < len(m.columns)-1 {
-				statement += `, `
-				values_statement += `, `
-			}
+			defaulted = append(defaulted, column)
 			continue
 		}
 		i++
 		values_statement += fmt.Sprintf(`$%d`, i)
-		if j < len(m.columns)-1 {
-			statement += `, `
-			values_statement += `, `
+		value, err := column.value(rv)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		values = append(values, value)
+	}
+	statement += `) `
+	values_statement += `)`
+	statement += values_statement
+	return statement, values, defaulted, nil
+}
+
+// UpsertOptions configures how Model.Upsert handles a conflict.
+type UpsertOptions struct {
+	// Conflict is the column whose conflict is handled. It must be the primary key or
+	// a unique column, and defaults to the primary key.
+	Conflict string
+
+	// Update is the columns that are overwritten when there is a conflict. It defaults
+	// to every column other than the conflict column, autoincrement columns and columns
+	// whose default is used.
+	Update []string
+
+	// DoNothing leaves the existing row untouched when there is a conflict.
+	DoNothing bool
+}
+
+// Upsert uses the Postgres connection to save the struct into the database table, handling
+// a conflict on the primary key or a unique column as configured by the options, instead of
+// failing.
+func (m *Model[T]) Upsert(v T, options UpsertOptions) error {
+	return m.UpsertContext(context.Background(), v, options)
+}
+
+// UpsertContext is like Upsert, but uses the given context for the statement.
+func (m *Model[T]) UpsertContext(ctx context.Context, v T, options UpsertOptions) error {
+	statement, values, err := m.compileUpsert(reflect.ValueOf(v), options)
+	if err != nil {
+		return err
+	}
+
+	e, err := m.executor()
+	if err != nil {
+		return err
+	}
+	_, err = sql.Execute(ctx, e, statement, values...)
+	return err
+}
+
+// compileUpsert makes an upsert statement for the struct in rv from the options, and
+// returns it with the pgx arguments for it.
+//
+// If the conflict column is autoincrement, the struct's value is inserted when it is not a
+// zero value, so that the conflict can happen; otherwise, the row is always new.
+func (m *Model[T]) compileUpsert(rv reflect.Value, options UpsertOptions) (string, []any, error) {
+	target, err := m.conflictTarget(options)
+	if err != nil {
+		return "", nil, err
+	}
+	statement, values, _, err := m.compileInsert(rv, target.name)
+	if err != nil {
+		return "", nil, err
+	}
+	conflict, err := m.compileConflict(rv, target, options)
+	if err != nil {
+		return "", nil, err
+	}
+	return statement + conflict + `;`, values, nil
+}
+
+// conflictTarget returns the column whose conflict is handled by an upsert with the options.
+func (m *Model[T]) conflictTarget(options UpsertOptions) (Column, error) {
+	if options.Conflict == "" {
+		pk, err := m.primaryKey()
+		if err != nil {
+			return Column{}, fmt.Errorf("a conflict column must be given: %w", err)
 		}
-		field := rv.FieldByName(column.name)
-		var value any
-		if column.nullable {
-			// call the Optional.Nil method
-			nilcheck := field.MethodByName("Nil").Call([]reflect.Value{})
-			if nilcheck[0].Bool() { // if the optional is nil
-				values = append(values, nil)
-				continue
+		return pk, nil
+	}
+	column, ok := m.column(options.Conflict)
+	if !ok {
+		return Column{}, fmt.Errorf("conflict column %s is not on the model", options.Conflict)
+	}
+	if !column.primarykey && !column.unique {
+		return Column{}, fmt.Errorf("conflict column %s must be a primary key or unique", options.Conflict)
+	}
+	return column, nil
+}
+
+// compileConflict makes the ON CONFLICT clause of an upsert of the struct in rv on the
+// target column from the options.
+func (m *Model[T]) compileConflict(rv reflect.Value, target Column, options UpsertOptions) (string, error) {
+	statement := fmt.Sprintf(` ON CONFLICT (%s) DO `, sql.Identifier(target.name))
+	if options.DoNothing {
+		return statement + `NOTHING`, nil
+	}
+
+	update := options.Update
+	if len(update) == 0 {
+		for _, column := range m.columns {
+			// a column whose default is used would overwrite the stored value with the default
+			if column.name != target.name && !column.usesDefault(rv) {
+				update = append(update, column.name)
 			}
+		}
+	}
+	if len(update) == 0 {
+		return statement + `NOTHING`, nil
+	}
+
+	statement += `UPDATE SET `
+	for i, name := range update {
+		if _, ok := m.column(name); !ok {
+			return "", fmt.Errorf("update column %s is not on the model", name)
+		}
+		if i > 0 {
+			statement += `, `
+		}
+		statement += fmt.Sprintf(`%s = EXCLUDED.%s`, sql.Identifier(name), sql.Identifier(name))
+	}
+	return statement, nil
+}
+
+// Update uses the Postgres connection to update the row in the database table that has the
+// same primary key as the struct. Every column other than the primary key, and any
+// autoincrement column, is set to the struct's value after being validated.
+//
+// ErrNoPrimaryKey is returned if the model does not have a primary key, and ErrNotFound
+// is returned if no row has the struct's primary key.
+func (m *Model[T]) Update(v T) error {
+	return m.UpdateContext(context.Background(), v)
+}
+
+// UpdateContext is like Update, but uses the given context for the statement.
+func (m *Model[T]) UpdateContext(ctx context.Context, v T) error {
+	statement, values, err := m.compileUpdate(reflect.ValueOf(v))
+	if err != nil {
+		return err
+	}
+
+	e, err := m.executor()
+	if err != nil {
+		return err
+	}
+	tag, err := sql.Execute(ctx, e, statement, values...)
+	if err != nil {
+		return err
+	}
+	return expectRows(tag)
+}
 
-			v := field.MethodByName("Value").Call([]reflect.Value{}) // call the Optional.Value method
-			value = v[0].Interface()
-		} else {
-			value = field.Interface()
+// compileUpdate makes an UPDATE statement for the struct in rv, keyed on the primary key,
+// and returns it with the pgx arguments for it.
+func (m *Model[T]) compileUpdate(rv reflect.Value) (string, []any, error) {
+	pk, err := m.primaryKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	statement := fmt.Sprintf(`UPDATE %s SET `, sql.Identifier(m.name))
+	values := []any{}
+	for _, column := range m.columns {
+		if column.primarykey || column.autoincrement {
+			continue
+		}
+		value, err := column.value(rv)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(values) > 0 {
+			statement += `, `
 		}
 		values = append(values, value)
-		for validator, rv := range column.validators {
-			err := validator.Validate(value, rv...)
-			if err != nil {
-				return err
-			}
+		statement += fmt.Sprintf(`%s = $%d`, sql.Identifier(column.name), len(values))
+	}
+	if len(values) == 0 {
+		return "", nil, fmt.Errorf("model %s has no columns to update", m.name)
+	}
+
+	pkvalue, err := pk.value(rv)
+	if err != nil {
+		return "", nil, err
+	}
+	values = append(values, pkvalue)
+	statement += fmt.Sprintf(` WHERE %s = $%d;`, sql.Identifier(pk.name), len(values))
+	return statement, values, nil
+}
+
+// expectRows returns ErrNotFound if the statement with the command tag did not affect
+// any rows.
+func expectRows(tag pgconn.CommandTag) error {
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete uses the Postgres connection to delete the row in the database table that has
+// the same primary key as the struct.
+//
+// ErrNoPrimaryKey is returned if the model does not have a primary key, and ErrNotFound
+// is returned if no row has the struct's primary key.
+func (m *Model[T]) Delete(v T) error {
+	return m.DeleteContext(context.Background(), v)
+}
+
+// DeleteContext is like Delete, but uses the given context for the statement.
+func (m *Model[T]) DeleteContext(ctx context.Context, v T) error {
+	statement, values, err := m.compileDelete(reflect.ValueOf(v))
+	if err != nil {
+		return err
+	}
+
+	e, err := m.executor()
+	if err != nil {
+		return err
+	}
+	tag, err := sql.Execute(ctx, e, statement, values...)
+	if err != nil {
+		return err
+	}
+	return expectRows(tag)
+}
+
+// compileDelete makes a DELETE statement for the struct in rv, keyed on the primary key,
+// and returns it with the pgx arguments for it.
+func (m *Model[T]) compileDelete(rv reflect.Value) (string, []any, error) {
+	pk, err := m.primaryKey()
+	if err != nil {
+		return "", nil, err
+	}
+	statement := fmt.Sprintf(`DELETE FROM %s WHERE %s = $1;`, sql.Identifier(m.name), sql.Identifier(pk.name))
+	return statement, []any{pk.fieldValue(rv)}, nil
+}
+
+// column returns the column of the model with the given name.
+func (m *Model[T]) column(name string) (Column, bool) {
+	return columnByName(m.columns, name)
+}
+
+// relation returns the relation field of the model with the given name.
+func (m *Model[T]) relation(name string) (relation, bool) {
+	for _, r := range m.relations {
+		if r.name == name {
+			return r, true
 		}
 	}
-	statement += `) `
-	values_statement += `);`
-	statement += values_statement
-	_, err := sql.Execute(statement, values...)
-	return err
+	return relation{}, false
+}
+
+// primaryKey returns the primary key column of the model, or ErrNoPrimaryKey if the
+// model does not have one.
+func (m *Model[T]) primaryKey() (Column, error) {
+	for _, column := range m.columns {
+		if column.primarykey {
+			return column, nil
+		}
+	}
+	return Column{}, fmt.Errorf("model %s: %w", m.name, ErrNoPrimaryKey)
 }
 
 // Create uses the Postgres connection to create the table in the database, if it does not
 // already exist.
 func (m *Model[T]) Create() error {
-	statement := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (`, m.name)
+	return m.CreateContext(context.Background())
+}
+
+// CreateContext is like Create, but uses the given context for the statement.
+func (m *Model[T]) CreateContext(ctx context.Context) error {
+	statement := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (`, sql.Identifier(m.name))
 	for i, column := range m.columns {
-		statement += fmt.Sprintf(`%s %s`, column.name, column.sqltype.String())
+		statement += fmt.Sprintf(`%s %s`, sql.Identifier(column.name), column.sqltype.String())
 		if !column.nullable {
 			statement += " NOT NULL"
 		}
+		if column.defaultvalue != "" {
+			statement += " DEFAULT " + column.defaultvalue
+		}
 		if column.primarykey {
 			statement += " PRIMARY KEY"
 		}
 		if column.unique {
 			statement += " UNIQUE"
 		}
+		if column.references != "" {
+			statement += fmt.Sprintf(" REFERENCES %s (%s) ON DELETE %s ON UPDATE %s",
+				sql.Identifier(column.references), sql.Identifier(column.referenced.name),
+				column.ondelete, column.onupdate)
+		}
 		if i < len(m.columns)-1 {
 			statement += `, `
 		}
 	}
 	statement += `);`
-	_, err := sql.Execute(statement)
+
+	e, err := m.executor()
+	if err != nil {
+		return err
+	}
+	_, err = sql.Execute(ctx, e, statement)
 	return err
 }
 
@@ -108,13 +495,47 @@ func New[T any]() (*Model[T], error) {
 	m.name = rt.Name()
 	m.t = rt
 
+	var pk *Column
 	for i := range rt.NumField() {
 		field := rt.Field(i)
+		if _, ok := field.Tag.Lookup("relation"); ok {
+			r, err := handleRelation(field)
+			if err != nil {
+				return nil, fmt.Errorf("relation %s error: %v", field.Name, err)
+			}
+			m.relations = append(m.relations, r)
+			continue
+		}
 		column, err := handleColumn(field)
 		if err != nil {
 			return nil, fmt.Errorf("column %s error: %v", field.Name, err)
 		}
+		if column.primarykey {
+			if pk != nil {
+				return nil, fmt.Errorf("column %s error: model already has a primary key", field.Name)
+			}
+			pk = &column
+		}
 		m.columns = append(m.columns, column)
 	}
+
+	// references are resolved once the primary key is known, so that a model can
+	// reference itself
+	for i := range m.columns {
+		if err := m.columns[i].resolveReference(rt, pk); err != nil {
+			return nil, fmt.Errorf("column %s error: %v", m.columns[i].name, err)
+		}
+	}
+	for _, r := range m.relations {
+		if err := r.validate(m.columns); err != nil {
+			return nil, fmt.Errorf("relation %s error: %v", r.name, err)
+		}
+	}
+	registryMu.Lock()
+	if pk != nil {
+		registeredPrimaryKeys[modelKey(rt)] = *pk
+	}
+	registeredModels[rt] = m.columns
+	registryMu.Unlock()
 	return m, nil
 }
@@ -0,0 +1,189 @@
+package sculpt
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+type upsertUser struct {
+	ID        int `pk:"true" autoincrement:"true"`
+	Name      string
+	CreatedAt Optional[time.Time] `default:"now()"`
+}
+
+func TestCompileUpsert(t *testing.T) {
+	m, err := New[upsertUser]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	createdAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		v         upsertUser
+		statement string
+		values    []any
+	}{
+		{
+			name:      "existing row",
+			v:         upsertUser{ID: 3, Name: "a"},
+			statement: `INSERT INTO "upsertuser" ("id", "name", "createdat") VALUES ($1, $2, DEFAULT) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name";`,
+			values:    []any{3, "a"},
+		},
+		{
+			name:      "new row",
+			v:         upsertUser{Name: "a"},
+			statement: `INSERT INTO "upsertuser" ("id", "name", "createdat") VALUES (DEFAULT, $1, DEFAULT) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name";`,
+			values:    []any{"a"},
+		},
+		{
+			name:      "set default column",
+			v:         upsertUser{ID: 3, Name: "a", CreatedAt: OptionalValue(createdAt)},
+			statement: `INSERT INTO "upsertuser" ("id", "name", "createdat") VALUES ($1, $2, $3) ON CONFLICT ("id") DO UPDATE SET "name" = EXCLUDED."name", "createdat" = EXCLUDED."createdat";`,
+			values:    []any{3, "a", createdAt},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, values, err := m.compileUpsert(reflect.ValueOf(tt.v), UpsertOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if statement != tt.statement {
+				t.Errorf("statement = %s, want %s", statement, tt.statement)
+			}
+			if !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("values = %v, want %v", values, tt.values)
+			}
+		})
+	}
+}
+
+func TestCompileSaveIgnoresAutoincrementValue(t *testing.T) {
+	m, err := New[upsertUser]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statement, _, _, err := m.compileSave(reflect.ValueOf(upsertUser{ID: 3, Name: "a"}), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `INSERT INTO "upsertuser" ("id", "name", "createdat") VALUES (DEFAULT, $1, DEFAULT);`
+	if statement != want {
+		t.Errorf("statement = %s, want %s", statement, want)
+	}
+}
+
+type concurrentCustomer struct {
+	ID     int               `pk:"true" autoincrement:"true"`
+	Orders []concurrentOrder `relation:"ConcurrentCustomerID"`
+}
+
+type concurrentOrder struct {
+	ID                   int `pk:"true" autoincrement:"true"`
+	ConcurrentCustomerID int `references:"concurrentCustomer"`
+}
+
+// TestNewConcurrent makes models concurrently, as parallel tests do, for go test -race to
+// check the registries of models.
+func TestNewConcurrent(t *testing.T) {
+	customers, err := New[concurrentCustomer]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := customers.relation("Orders")
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			if _, err := New[concurrentCustomer](); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := New[concurrentOrder](); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			// as when a preloaded query is done
+			if related, ok := registeredColumns(r.t); ok {
+				if _, _, err := r.keys(customers.t, customers.columns, related); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+type noColumns struct {
+	Orders []concurrentOrder `relation:"ConcurrentCustomerID"`
+}
+
+func TestSaveManyWithoutColumns(t *testing.T) {
+	m, err := New[noColumns]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the model is rejected before a database is needed
+	if err := m.SaveMany([]noColumns{{}}); err == nil {
+		t.Error("SaveMany of a model without columns returned no error")
+	}
+	if err := m.SaveManyReturning([]noColumns{{}}); err == nil {
+		t.Error("SaveManyReturning of a model without columns returned no error")
+	}
+}
+
+type referencedUser struct {
+	ID int64 `pk:"true" autoincrement:"true"`
+}
+
+func TestReferences(t *testing.T) {
+	if _, err := New[referencedUser](); err != nil {
+		t.Fatal(err)
+	}
+
+	type setNull struct {
+		UserID int64 `references:"referencedUser" ondelete:"SET NULL"`
+	}
+	if _, err := New[setNull](); err == nil {
+		t.Error("SET NULL on a column that is not an Optional returned no error")
+	}
+	type optionalSetNull struct {
+		UserID Optional[int64] `references:"referencedUser" ondelete:"SET NULL"`
+	}
+	if _, err := New[optionalSetNull](); err != nil {
+		t.Error(err)
+	}
+
+	type otherType struct {
+		UserID int `references:"referencedUser"`
+	}
+	if _, err := New[otherType](); err == nil {
+		t.Error("reference with a Go type other than the primary key's returned no error")
+	}
+
+	type qualified struct {
+		UserID int64 `references:"github.com/tiredkangaroo/sculpt.referencedUser"`
+	}
+	m, err := New[qualified]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.columns[0].references != "referencedUser" {
+		t.Errorf("references = %s, want referencedUser", m.columns[0].references)
+	}
+	type otherPackage struct {
+		UserID int64 `references:"example.com/other.referencedUser"`
+	}
+	if _, err := New[otherPackage](); err == nil {
+		t.Error("reference to a model with the same name in another package returned no error")
+	}
+}
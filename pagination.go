@@ -0,0 +1,253 @@
+package sculpt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/tiredkangaroo/sculpt/internals/sql"
+)
+
+// Page is a page of results from a query using keyset pagination.
+type Page[T any] struct {
+	// Results is the results in the page.
+	Results []T
+
+	// Next is the cursor for the page after this one, to be given to After. It is empty
+	// if there is no page after this one.
+	Next string
+
+	// Previous is the cursor for the page before this one, to be given to Before. It is
+	// empty if there is no page before this one.
+	Previous string
+}
+
+// After makes Page return the page of results after the cursor, which is obtained from
+// Page.Next.
+func (q *Query[T]) After(cursor string) *Query[T] {
+	q.after, q.before = cursor, ""
+	return q
+}
+
+// Before makes Page return the page of results before the cursor, which is obtained from
+// Page.Previous.
+func (q *Query[T]) Before(cursor string) *Query[T] {
+	q.before, q.after = cursor, ""
+	return q
+}
+
+// PageSize sets the maximum number of results in a page returned by Page.
+func (q *Query[T]) PageSize(n int) *Query[T] {
+	if n <= 0 {
+		q.err = fmt.Errorf("page size must be positive: %d", n)
+		return q
+	}
+	q.pagesize = n
+	return q
+}
+
+// Page compiles and executes the query, returning a page of results. See PageContext for
+// more information.
+func (q *Query[T]) Page() (Page[T], error) {
+	return q.PageContext(context.Background())
+}
+
+// PageContext is like Page, but uses the given context for the query.
+//
+// Pages are found using keyset pagination: the columns given to OrderBy, followed by the
+// primary key if it is not one of them, are compared to those of the row a cursor was made
+// from. This is fast on large tables, and stable when rows are inserted concurrently. The
+// ordering columns must all be in the same direction, and cannot be Optional columns.
+func (q *Query[T]) PageContext(ctx context.Context) (Page[T], error) {
+	if q.err != nil {
+		return Page[T]{}, q.err
+	}
+	if q.pagesize == 0 {
+		return Page[T]{}, fmt.Errorf("page size must be set to use pagination")
+	}
+	keys, err := q.keys()
+	if err != nil {
+		return Page[T]{}, err
+	}
+	paged, err := q.paged(keys)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	backwards := q.before != ""
+
+	results, err := paged.DoContext(ctx)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	more := len(results) > q.pagesize
+	if more {
+		results = results[:q.pagesize]
+	}
+	if backwards {
+		slices.Reverse(results)
+	}
+
+	page := Page[T]{Results: results}
+	if len(results) == 0 {
+		return page, nil
+	}
+	if more || backwards {
+		if page.Next, err = encodeCursor(results[len(results)-1], q.model, keys); err != nil {
+			return Page[T]{}, err
+		}
+	}
+	if (more && backwards) || q.after != "" {
+		if page.Previous, err = encodeCursor(results[0], q.model, keys); err != nil {
+			return Page[T]{}, err
+		}
+	}
+	return page, nil
+}
+
+// paged returns a copy of the query that finds the page, ordered by the keys. The copy
+// finds one more result than the page size, to find whether there is another page. For a
+// page before a cursor, it is ordered in reverse, and its results must be put back in order.
+func (q *Query[T]) paged(keys []orderBy) (*Query[T], error) {
+	paged := *q
+	paged.orderby = slices.Clone(keys)
+	paged.conditions = slices.Clone(q.conditions)
+	limit := q.pagesize + 1 // one more than the page size, to find whether there is another page
+	paged.limit = &limit
+	paged.offset = nil
+	if len(q.fields) > 0 {
+		// the cursor is made from the keys, and so they must be scanned
+		paged.fields = slices.Clone(q.fields)
+		for _, key := range keys {
+			if !slices.ContainsFunc(paged.fields, func(s selection) bool {
+				return s.model == key.model && s.column.name == key.column
+			}) {
+				column, _ := q.model.column(key.column)
+				paged.fields = append(paged.fields, selection{model: key.model, column: column})
+			}
+		}
+	}
+
+	if q.before != "" {
+		// read the page before the cursor in reverse, then put it back in order
+		for i := range paged.orderby {
+			paged.orderby[i].direction = reverse(paged.orderby[i].direction)
+		}
+	}
+	cursor := q.after + q.before
+	if cursor != "" {
+		values, err := decodeCursor(cursor, q.model, keys)
+		if err != nil {
+			return nil, err
+		}
+		paged.conditions = append(paged.conditions, keysetCondition(paged.orderby, values))
+	}
+	return &paged, nil
+}
+
+// keys returns the columns that order the query for keyset pagination, which are the
+// columns given to OrderBy followed by the primary key, if the model has one and it is
+// not already used.
+func (q *Query[T]) keys() ([]orderBy, error) {
+	if len(q.orderby) == 0 {
+		return nil, fmt.Errorf("pagination requires the query to be ordered with OrderBy")
+	}
+	keys := slices.Clone(q.orderby)
+	direction := keys[0].direction
+	if pk, err := q.model.primaryKey(); err == nil && !slices.ContainsFunc(keys, func(o orderBy) bool {
+		return o.model == q.model.name && o.column == pk.name
+	}) {
+		keys = append(keys, orderBy{model: q.model.name, column: pk.name, direction: direction})
+	}
+
+	for _, key := range keys {
+		if key.model != q.model.name {
+			// the cursor is made from the fields of a result, which are of the query's model
+			return nil, fmt.Errorf("cannot paginate on %s.%s: it is not a column of the model %s", key.model, key.column, q.model.name)
+		}
+		if key.direction != direction {
+			return nil, fmt.Errorf("pagination requires every order column to be in the same direction")
+		}
+		column, _ := q.model.column(key.column)
+		if column.nullable {
+			return nil, fmt.Errorf("cannot paginate on optional column %s", column.name)
+		}
+	}
+	return keys, nil
+}
+
+// keysetCondition returns a Condition that is true for rows after the values of the keys,
+// in the direction they are ordered.
+func keysetCondition(keys []orderBy, values []any) Condition {
+	names := make([]string, len(keys))
+	columns := make([]string, len(keys))
+	placeholders := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = key.column
+		columns[i] = "%s"
+		placeholders[i] = "$<_sculpt>"
+	}
+	operator := ">"
+	if keys[0].direction == sql.DESC {
+		operator = "<"
+	}
+	return Condition{
+		columns: names,
+		format:  fmt.Sprintf("(%s) %s (%s)", strings.Join(columns, ", "), operator, strings.Join(placeholders, ", ")),
+		a:       values,
+	}
+}
+
+// reverse returns the opposite direction.
+func reverse(direction sql.ASCDESC) sql.ASCDESC {
+	if direction == sql.DESC {
+		return sql.ASC
+	}
+	return sql.DESC
+}
+
+// encodeCursor makes a cursor from the values of the keys in the result. The cursor is
+// URL-safe base64 of a JSON array of the values.
+func encodeCursor[T any](result T, m *Model[T], keys []orderBy) (string, error) {
+	rv := reflect.ValueOf(result)
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		column, _ := m.column(key.column)
+		values[i] = column.fieldValue(rv)
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("cannot make cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// decodeCursor returns the values of the keys in a cursor made by encodeCursor, with the
+// types of their columns.
+func decodeCursor[T any](cursor string, m *Model[T], keys []orderBy) ([]any, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	raw := []json.RawMessage{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if len(raw) != len(keys) {
+		return nil, fmt.Errorf("invalid cursor: it is for a query ordered differently")
+	}
+
+	values := make([]any, len(keys))
+	for i, key := range keys {
+		column, _ := m.column(key.column)
+		v := reflect.New(column.t)
+		if err := json.Unmarshal(raw[i], v.Interface()); err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		values[i] = v.Elem().Interface()
+	}
+	return values, nil
+}
@@ -0,0 +1,224 @@
+package sculpt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/tiredkangaroo/sculpt/internals/sql"
+
+	"github.com/google/uuid"
+)
+
+type pageEvent struct {
+	ID        int `pk:"true" autoincrement:"true"`
+	CreatedAt time.Time
+	Token     uuid.UUID
+	Data      []byte
+	Note      Optional[string]
+}
+
+func pageEventModel(t *testing.T) *Model[pageEvent] {
+	t.Helper()
+	m, err := New[pageEvent]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	m := pageEventModel(t)
+	keys := []orderBy{
+		{column: "CreatedAt", direction: sql.ASC},
+		{column: "Token", direction: sql.ASC},
+		{column: "Data", direction: sql.ASC},
+		{column: "ID", direction: sql.ASC},
+	}
+	event := pageEvent{
+		ID:        42,
+		CreatedAt: time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.FixedZone("NZST", 12*60*60)),
+		Token:     uuid.MustParse("6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		Data:      []byte{0, 1, 2, 255},
+	}
+
+	cursor, err := encodeCursor(event, m, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := decodeCursor(cursor, m, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != len(keys) {
+		t.Fatalf("got %d values, want %d", len(values), len(keys))
+	}
+	if v, ok := values[0].(time.Time); !ok || !v.Equal(event.CreatedAt) {
+		t.Errorf("CreatedAt = %#v, want %v", values[0], event.CreatedAt)
+	}
+	if v, ok := values[1].(uuid.UUID); !ok || v != event.Token {
+		t.Errorf("Token = %#v, want %v", values[1], event.Token)
+	}
+	if v, ok := values[2].([]byte); !ok || !bytes.Equal(v, event.Data) {
+		t.Errorf("Data = %#v, want %v", values[2], event.Data)
+	}
+	if v, ok := values[3].(int); !ok || v != event.ID {
+		t.Errorf("ID = %#v, want %d", values[3], event.ID)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	m := pageEventModel(t)
+	keys := []orderBy{
+		{column: "CreatedAt", direction: sql.ASC},
+		{column: "ID", direction: sql.ASC},
+	}
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"not json", encode("[1,")},
+		{"not an array", encode(`{"ID":1}`)},
+		{"too few values", encode(`["2024-05-06T07:08:09Z"]`)},
+		{"too many values", encode(`["2024-05-06T07:08:09Z",1,2]`)},
+		{"wrong type", encode(`["2024-05-06T07:08:09Z","one"]`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decodeCursor(tt.cursor, m, keys); err == nil {
+				t.Errorf("decodeCursor(%q) returned no error", tt.cursor)
+			}
+		})
+	}
+}
+
+func TestKeys(t *testing.T) {
+	m := pageEventModel(t)
+
+	keys, err := m.Query().OrderBy("CreatedAt", Descending).keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []orderBy{
+		{model: "pageEvent", column: "CreatedAt", direction: sql.DESC},
+		{model: "pageEvent", column: "ID", direction: sql.DESC},
+	}
+	if len(keys) != len(want) || keys[0] != want[0] || keys[1] != want[1] {
+		t.Errorf("keys = %v, want %v", keys, want)
+	}
+
+	if _, err := m.Query().keys(); err == nil {
+		t.Error("keys of an unordered query returned no error")
+	}
+	if _, err := m.Query().OrderBy("CreatedAt", Ascending).OrderBy("Token", Descending).keys(); err == nil {
+		t.Error("keys in mixed directions returned no error")
+	}
+	if _, err := m.Query().OrderBy("Note", Ascending).keys(); err == nil {
+		t.Error("keys with an optional column returned no error")
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	m := pageEventModel(t)
+	q := m.Query()
+	createdAt := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		direction sql.ASCDESC
+		want      string
+	}{
+		// After on an ascending query, or Before on a descending query once reversed
+		{"ascending", sql.ASC, `("createdat", "id") > ($1, $2)`},
+		// After on a descending query, or Before on an ascending query once reversed
+		{"descending", sql.DESC, `("createdat", "id") < ($1, $2)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := []orderBy{
+				{column: "CreatedAt", direction: tt.direction},
+				{column: "ID", direction: tt.direction},
+			}
+			j := 0
+			s, a, err := keysetCondition(keys, []any{createdAt, 7}).compile(q.resolve, &j)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != tt.want {
+				t.Errorf("condition = %s, want %s", s, tt.want)
+			}
+			if len(a) != 2 || a[0] != createdAt || a[1] != 7 {
+				t.Errorf("arguments = %v, want [%v 7]", a, createdAt)
+			}
+		})
+	}
+}
+
+func TestReverse(t *testing.T) {
+	if reverse(sql.ASC) != sql.DESC {
+		t.Error("reverse(ASC) is not DESC")
+	}
+	if reverse(sql.DESC) != sql.ASC {
+		t.Error("reverse(DESC) is not ASC")
+	}
+}
+
+func TestPagedQuery(t *testing.T) {
+	m := pageEventModel(t)
+	keys := []orderBy{{column: "ID", direction: sql.ASC}}
+	cursor, err := encodeCursor(pageEvent{ID: 10}, m, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		q    *Query[pageEvent]
+		want string
+	}{
+		{
+			name: "first page",
+			q:    m.Query().IncludeFields("Note").OrderBy("ID", Ascending).PageSize(5),
+			want: `SELECT "note", "id" FROM "pageevent" ORDER BY "id" ASC LIMIT $1;`,
+		},
+		{
+			name: "after",
+			q:    m.Query().OrderBy("ID", Ascending).PageSize(5).After(cursor),
+			want: `SELECT "id", "createdat", "token", "data", "note" FROM "pageevent" WHERE ("id") > ($1) ORDER BY "id" ASC LIMIT $2;`,
+		},
+		{
+			name: "before",
+			q:    m.Query().OrderBy("ID", Ascending).PageSize(5).Before(cursor),
+			want: `SELECT "id", "createdat", "token", "data", "note" FROM "pageevent" WHERE ("id") < ($1) ORDER BY "id" DESC LIMIT $2;`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := tt.q.keys()
+			if err != nil {
+				t.Fatal(err)
+			}
+			paged, err := tt.q.paged(keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, a, err := paged.compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != tt.want {
+				t.Errorf("statement = %s, want %s", s, tt.want)
+			}
+			// the limit is one more than the page size
+			if a[len(a)-1] != 6 {
+				t.Errorf("limit = %v, want 6", a[len(a)-1])
+			}
+		})
+	}
+}
@@ -1,23 +1,102 @@
 package sculpt
 
 import (
+	"context"
 	"fmt"
+	"iter"
 	"reflect"
 	"slices"
 	"strings"
 
 	"github.com/tiredkangaroo/sculpt/internals/sql"
+
+	"github.com/jackc/pgx/v5"
 )
 
 type Query[T any] struct {
 	distinct bool
 	model    *Model[T]
 
-	ascdesc sql.ASCDESC
-	orderby string
+	// all explicitly allows a query without conditions to affect every row, see All.
+	all bool
+
+	orderby []orderBy
+	limit   *int
+	offset  *int
+
+	// after, before and pagesize are used for keyset pagination, see Page.
+	after    string
+	before   string
+	pagesize int
 
-	fields     []string
+	fields     []selection
 	conditions []Condition
+
+	// joins are the models joined with the query, see Join.
+	joins []join
+
+	// preloads are the relations loaded into the results, see Preload.
+	preloads []string
+
+	// err is an error made while building the query. It is returned when the query is
+	// compiled.
+	err error
+}
+
+// Direction is the direction in which a column orders the results of a query.
+type Direction uint8
+
+const (
+	Ascending Direction = iota
+	Descending
+)
+
+// orderBy is a column that orders the results of a query.
+type orderBy struct {
+	// model is the name of the model the column is on, either the query's model or a
+	// joined model.
+	model     string
+	column    string
+	direction sql.ASCDESC
+}
+
+// OrderBy orders the results by the column, in the given direction. It can be called more
+// than once to order by multiple columns, with earlier calls taking precedence. The column
+// can be a qualified column of a model joined before, as in Customer.Name (see Join).
+//
+// An error is returned when the query is done if the column does not exist.
+func (q *Query[T]) OrderBy(column string, direction Direction) *Query[T] {
+	model, c, err := q.lookup(column)
+	if err != nil {
+		q.err = fmt.Errorf("cannot order by %s: %v", column, err)
+		return q
+	}
+	o := orderBy{model: model, column: c.name, direction: sql.ASC}
+	if direction == Descending {
+		o.direction = sql.DESC
+	}
+	q.orderby = append(q.orderby, o)
+	return q
+}
+
+// Limit limits the number of results to at most n.
+func (q *Query[T]) Limit(n int) *Query[T] {
+	if n < 0 {
+		q.err = fmt.Errorf("limit cannot be negative: %d", n)
+		return q
+	}
+	q.limit = &n
+	return q
+}
+
+// Offset skips the first n results.
+func (q *Query[T]) Offset(n int) *Query[T] {
+	if n < 0 {
+		q.err = fmt.Errorf("offset cannot be negative: %d", n)
+		return q
+	}
+	q.offset = &n
+	return q
 }
 
 // Distinct makes the query return ONLY distinct results.
@@ -26,36 +105,98 @@ func (q *Query[T]) Distinct() *Query[T] {
 	return q
 }
 
-// AscendingOrder sets the order of the results to ascending.
+// AscendingOrder sets the order of the results to ascending, for the column last given
+// to OrderBy.
 func (q *Query[T]) AscendingOrder() *Query[T] {
-	q.ascdesc = sql.ASC
-	return q
+	return q.setDirection(sql.ASC)
 }
 
-// DescendingOrder sets the order of the results to descending.
+// DescendingOrder sets the order of the results to descending, for the column last given
+// to OrderBy.
 func (q *Query[T]) DescendingOrder() *Query[T] {
-	q.ascdesc = sql.DESC
+	return q.setDirection(sql.DESC)
+}
+
+// setDirection sets the direction of the column last given to OrderBy.
+func (q *Query[T]) setDirection(direction sql.ASCDESC) *Query[T] {
+	if len(q.orderby) == 0 {
+		q.err = fmt.Errorf("cannot use ascending or descending order without an order field")
+		return q
+	}
+	q.orderby[len(q.orderby)-1].direction = direction
 	return q
 }
 
 // IncludeFields allows manual specification of which fields to populate in the result. If
-// not called, or left empty, all fields will be given.
+// not called, or left empty, all fields will be given. Fields that are not included are left
+// as zero values in the results.
+//
+// A field can be a qualified column of a model joined before, as in Customer.Name (see Join).
+// It is selected, such as to count its distinct values with Distinct and Count, but is not
+// scanned into the results, which are of the query's model; use Select for joined models.
 //
-// It panics if a field provided does not exist on the model.
+// It panics if a field provided does not exist.
 func (q *Query[T]) IncludeFields(f ...string) *Query[T] {
-	columnNames := make([]string, len(q.model.columns))
-	for i, c := range q.model.columns {
-		columnNames[i] = c.name
-	}
 	for _, field := range f {
-		if !slices.Contains(columnNames, field) {
-			panic(fmt.Sprintf("field %s is not on the model", field))
+		model, column, err := q.lookup(field)
+		if err != nil {
+			panic(fmt.Sprintf("field %s: %v", field, err))
 		}
-		q.fields = append(q.fields, field)
+		q.fields = append(q.fields, selection{model: model, column: column})
 	}
 	return q
 }
 
+// selection is a column selected by a query, of the query's model or of a joined model.
+type selection struct {
+	// model is the name of the model the column is on.
+	model  string
+	column Column
+}
+
+// selected returns the columns selected by the query, which are the fields given to
+// IncludeFields, or every column of the model.
+func (q *Query[T]) selected() []selection {
+	if len(q.fields) == 0 {
+		selected := make([]selection, len(q.model.columns))
+		for i, column := range q.model.columns {
+			selected[i] = selection{model: q.model.name, column: column}
+		}
+		return selected
+	}
+	selected := slices.Clone(q.fields)
+	// the columns relating the results to their preloaded relations must be scanned
+	for _, name := range q.preloads {
+		r, _ := q.model.relation(name)
+		var key Column
+		if r.many {
+			key, _ = q.model.primaryKey()
+		} else {
+			key, _ = q.model.column(r.column)
+		}
+		if key.name != "" && !slices.ContainsFunc(selected, func(s selection) bool {
+			return s.model == q.model.name && s.column.name == key.name
+		}) {
+			selected = append(selected, selection{model: q.model.name, column: key})
+		}
+	}
+	return selected
+}
+
+// targets returns the targets that the selected columns are scanned into, for the result
+// rv. The columns of joined models are not part of the result, and so are discarded.
+func (q *Query[T]) targets(rv reflect.Value, selected []selection) []any {
+	targets := make([]any, len(selected))
+	for i, s := range selected {
+		if s.model != q.model.name {
+			targets[i] = new(any)
+			continue
+		}
+		targets[i] = rv.FieldByName(s.column.name).Addr().Interface()
+	}
+	return targets
+}
+
 // Conditions adds conditions to the query. These conditions are combined, in order to
 // specifically get the results that meet the criteria.
 func (q *Query[T]) Conditions(c ...Condition) *Query[T] {
@@ -63,15 +204,104 @@ func (q *Query[T]) Conditions(c ...Condition) *Query[T] {
 	return q
 }
 
+// All explicitly allows the query to affect every row in the table when it has no
+// conditions. It is required in order to use Delete without conditions.
+func (q *Query[T]) All() *Query[T] {
+	q.all = true
+	return q
+}
+
+// resolve resolves the name of a column of the model, or a qualified column of a joined
+// model (see lookup), to its quoted identifier, for use in conditions.
+func (q *Query[T]) resolve(name string) (string, error) {
+	model, column, err := q.lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return q.identifier(model, column.name), nil
+}
+
+// compileWhere makes the WHERE clause of the query, with a leading space, and its arguments.
+func (q *Query[T]) compileWhere(j *int) (string, []any, error) {
+	if len(q.conditions) == 0 {
+		return "", []any{}, nil
+	}
+	statement, a, err := compileConditions(q.conditions, q.resolve, j)
+	if err != nil {
+		return "", nil, err
+	}
+	return " WHERE " + statement, a, nil
+}
+
+// compileConditions combines the conditions with AND, and returns them with their arguments.
+func compileConditions(conditions []Condition, resolve resolver, j *int) (string, []any, error) {
+	statement := ""
+	a := []any{} // pgx query arguments
+	for i, c := range conditions {
+		s, ca, err := c.compile(resolve, j)
+		if err != nil {
+			return "", nil, err
+		}
+		statement += s
+		if i != len(conditions)-1 {
+			statement += " AND "
+		}
+		a = append(a, ca...)
+	}
+	return statement, a, nil
+}
+
+// compileOrder makes the ORDER BY, LIMIT and OFFSET clauses of the query, and their arguments.
+func (q *Query[T]) compileOrder(j *int) (string, []any) {
+	statement := ""
+	a := []any{}
+	for i, o := range q.orderby {
+		if i == 0 {
+			statement += " ORDER BY "
+		} else {
+			statement += ", "
+		}
+		// column names cannot be placeholders, Postgres would order by a constant
+		statement += q.identifier(o.model, o.column)
+		switch o.direction {
+		case sql.ASC:
+			statement += " ASC"
+		case sql.DESC:
+			statement += " DESC"
+		}
+	}
+
+	if q.limit != nil {
+		*j++
+		statement += fmt.Sprintf(" LIMIT $%d", *j)
+		a = append(a, *q.limit)
+	}
+	if q.offset != nil {
+		*j++
+		statement += fmt.Sprintf(" OFFSET $%d", *j)
+		a = append(a, *q.offset)
+	}
+	return statement, a
+}
+
 // compile makes a SQL statement for pgx from the query.
 func (q *Query[T]) compile() (string, []any, error) {
+	selected := q.selected()
+	fields := make([]string, len(selected))
+	for i, s := range selected {
+		fields[i] = q.identifier(s.model, s.column.name)
+	}
+	return q.compileSelect(fields)
+}
+
+// compileSelect makes a SQL statement for pgx from the query, selecting the quoted fields.
+func (q *Query[T]) compileSelect(fields []string) (string, []any, error) {
+	if q.err != nil {
+		return "", nil, q.err
+	}
+
 	// start of query
 	statement := "SELECT "
-	if len(q.fields) == 0 {
-		for _, c := range q.model.columns {
-			q.fields = append(q.fields, c.name)
-		}
-	}
 
 	// distinct
 	if q.distinct {
@@ -79,47 +309,25 @@ func (q *Query[T]) compile() (string, []any, error) {
 	}
 
 	// continuing start of query
-	if len(q.fields) > 0 {
-		statement += strings.Join(q.fields, ", ")
+	if len(fields) > 0 {
+		statement += strings.Join(fields, ", ")
 	}
-	statement += fmt.Sprintf(" FROM %s ", q.model.name)
+	statement += " " + q.from()
 
 	// placeholders for pgx
-	a := []any{} // pgx query arguments
-	j := 0       // uses a counter to replace placeholders for pgx
+	j := 0 // uses a counter to replace placeholders for pgx
 
 	// WHERE
-	if len(q.conditions) > 0 {
-		statement += "WHERE "
-	}
-	for i, c := range q.conditions {
-		statement += replaceAllFunc(c.s, "<_sculpt>", func() string {
-			j++
-			return fmt.Sprintf("%d", j)
-		})
-		if i != len(q.conditions)-1 {
-			statement += " AND "
-		}
-		a = append(a, c.a...)
-	}
-
-	// ORDER BY
-	if q.orderby != "" {
-		j++
-		statement += fmt.Sprintf(" ORDER BY $%d", j)
-		a = append(a, q.orderby)
-	}
-	if q.ascdesc != sql.NoASCDESC && q.orderby == "" {
-		return "", nil, fmt.Errorf("cannot use ascending or descending order without an order field")
+	where, a, err := q.compileWhere(&j)
+	if err != nil {
+		return "", nil, err
 	}
+	statement += where
 
-	//     - ASC/DESC
-	switch q.ascdesc {
-	case sql.ASC:
-		statement += " ASC"
-	case sql.DESC:
-		statement += " DESC"
-	}
+	// ORDER BY, LIMIT and OFFSET
+	order, oa := q.compileOrder(&j)
+	statement += order
+	a = append(a, oa...)
 
 	statement += ";"
 	return statement, a, nil
@@ -127,33 +335,267 @@ func (q *Query[T]) compile() (string, []any, error) {
 
 // Do compiles and executes the query and returns the results.
 func (q *Query[T]) Do() ([]T, error) {
+	return q.DoContext(context.Background())
+}
+
+// DoContext is like Do, but uses the given context for the query.
+func (q *Query[T]) DoContext(ctx context.Context) ([]T, error) {
 	statement, a, err := q.compile()
 	if err != nil {
 		return nil, err
 	}
-	rows, err := sql.Query(statement, a...)
+	e, err := q.model.executor()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := sql.Query(ctx, e, statement, a...)
+	if err != nil {
+		return nil, err
+	}
+	results, err := q.scan(rows)
 	if err != nil {
 		return nil, err
 	}
+	if err := q.preload(ctx, e, results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// scan scans every row into a result, and closes the rows.
+func (q *Query[T]) scan(rows pgx.Rows) ([]T, error) {
 	defer rows.Close()
 	results := []T{}
 
 	for rows.Next() {
-		values := make([]any, len(q.model.columns))
-		for i, column := range q.model.columns {
-			values[i] = reflect.New(column.t).Interface()
-		}
-		err = rows.Scan(values...)
+		r, err := q.scanRow(rows)
 		if err != nil {
 			return nil, err
 		}
-		result := reflect.New(reflect.TypeFor[T]()).Elem()
-		for i, c := range q.model.columns {
-			value := reflect.ValueOf(values[i])
-			result.FieldByName(c.name).Set(value.Elem())
-		}
-		r := result.Interface().(T) // literally impossible to fail
 		results = append(results, r)
 	}
-	return results, nil
+	return results, rows.Err()
+}
+
+// scanRow scans the current row into a result. Only the selected columns are scanned,
+// leaving the other fields of the result as zero values.
+func (q *Query[T]) scanRow(rows pgx.Rows) (T, error) {
+	result := reflect.New(reflect.TypeFor[T]()).Elem()
+	if err := rows.Scan(q.targets(result, q.selected())...); err != nil {
+		var zero T
+		return zero, err
+	}
+	return result.Interface().(T), nil // literally impossible to fail
+}
+
+// Iter compiles and executes the query, and returns an iterator over the results. See
+// IterContext for more information.
+func (q *Query[T]) Iter() iter.Seq2[T, error] {
+	return q.IterContext(context.Background())
+}
+
+// IterContext is like Iter, but uses the given context for the query.
+//
+// Unlike Do, the results are not held in memory: each row is scanned as the loop reaches
+// it. If an error happens, it is yielded with a zero result and the iteration stops. The
+// rows are closed when the iteration finishes, including when the loop is broken early.
+// Relations cannot be loaded with Preload while iterating.
+//
+//	for user, err := range userModel.Query().Iter() {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func (q *Query[T]) IterContext(ctx context.Context) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		if len(q.preloads) > 0 {
+			yield(zero, fmt.Errorf("cannot iterate over a query with preloaded relations"))
+			return
+		}
+		statement, a, err := q.compile()
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		e, err := q.model.executor()
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		rows, err := sql.Query(ctx, e, statement, a...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			r, err := q.scanRow(rows)
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !yield(r, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
+
+// First compiles and executes the query, returning the first result. ErrNotFound is
+// returned if there are no results.
+func (q *Query[T]) First() (T, error) {
+	return q.FirstContext(context.Background())
+}
+
+// FirstContext is like First, but uses the given context for the query.
+func (q *Query[T]) FirstContext(ctx context.Context) (T, error) {
+	results, err := q.limited(1).DoContext(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	if len(results) == 0 {
+		var zero T
+		return zero, ErrNotFound
+	}
+	return results[0], nil
+}
+
+// One compiles and executes the query, returning its only result. ErrNotFound is returned
+// if there are no results, and ErrMultipleResults is returned if there is more than one.
+func (q *Query[T]) One() (T, error) {
+	return q.OneContext(context.Background())
+}
+
+// OneContext is like One, but uses the given context for the query.
+func (q *Query[T]) OneContext(ctx context.Context) (T, error) {
+	// a limit of 2 is enough to know whether there is more than one result
+	results, err := q.limited(2).DoContext(ctx)
+	var zero T
+	switch {
+	case err != nil:
+		return zero, err
+	case len(results) == 0:
+		return zero, ErrNotFound
+	case len(results) > 1:
+		return zero, ErrMultipleResults
+	}
+	return results[0], nil
+}
+
+// limited returns a copy of the query with a limit of n, unless the query already has a
+// smaller limit.
+func (q *Query[T]) limited(n int) *Query[T] {
+	limited := *q
+	if q.limit == nil || *q.limit > n {
+		limited.limit = &n
+	}
+	return &limited
+}
+
+// Exists returns whether the query has any results, using SELECT EXISTS.
+func (q *Query[T]) Exists() (bool, error) {
+	return q.ExistsContext(context.Background())
+}
+
+// ExistsContext is like Exists, but uses the given context for the query.
+func (q *Query[T]) ExistsContext(ctx context.Context) (bool, error) {
+	var exists bool
+	err := q.wrapped(ctx, "SELECT EXISTS (%s);", &exists)
+	return exists, err
+}
+
+// Count returns the number of results of the query, using COUNT(*).
+func (q *Query[T]) Count() (int64, error) {
+	return q.CountContext(context.Background())
+}
+
+// CountContext is like Count, but uses the given context for the query.
+func (q *Query[T]) CountContext(ctx context.Context) (int64, error) {
+	var count int64
+	err := q.wrapped(ctx, "SELECT COUNT(*) FROM (%s) AS counted;", &count)
+	return count, err
+}
+
+// wrapped compiles the query, wraps it in the format as a subquery, and scans the
+// single value returned by the statement into dest.
+func (q *Query[T]) wrapped(ctx context.Context, format string, dest any) error {
+	subquery, a, err := q.compile()
+	if err != nil {
+		return err
+	}
+	statement := fmt.Sprintf(format, strings.TrimSuffix(subquery, ";"))
+
+	e, err := q.model.executor()
+	if err != nil {
+		return err
+	}
+	rows, err := sql.Query(ctx, e, statement, a...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return ErrNotFound
+	}
+	if err := rows.Scan(dest); err != nil {
+		return err
+	}
+	rows.Close()
+	return rows.Err()
+}
+
+// Delete deletes the rows that meet the query's conditions, and returns the number of rows
+// deleted. To prevent a table from being emptied by accident, a query without conditions
+// returns an error unless All is used. Since DELETE only uses the conditions, a query that
+// is ordered, limited, offset, distinct or paginated also returns an error.
+func (q *Query[T]) Delete() (int64, error) {
+	return q.DeleteContext(context.Background())
+}
+
+// DeleteContext is like Delete, but uses the given context for the statement.
+func (q *Query[T]) DeleteContext(ctx context.Context) (int64, error) {
+	if q.err != nil {
+		return 0, q.err
+	}
+	if len(q.conditions) == 0 && !q.all {
+		return 0, fmt.Errorf("cannot delete without conditions, use All to delete every row")
+	}
+	switch {
+	case len(q.joins) > 0:
+		return 0, fmt.Errorf("cannot delete with a query that has joins")
+	case q.limit != nil || q.offset != nil:
+		return 0, fmt.Errorf("cannot delete with a query that has a limit or offset")
+	case len(q.orderby) > 0:
+		return 0, fmt.Errorf("cannot delete with a query that is ordered")
+	case q.distinct:
+		return 0, fmt.Errorf("cannot delete with a distinct query")
+	case q.after != "" || q.before != "" || q.pagesize != 0:
+		return 0, fmt.Errorf("cannot delete with a paginated query")
+	}
+	j := 0
+	where, a, err := q.compileWhere(&j)
+	if err != nil {
+		return 0, err
+	}
+	statement := fmt.Sprintf("DELETE FROM %s%s;", sql.Identifier(q.model.name), where)
+
+	e, err := q.model.executor()
+	if err != nil {
+		return 0, err
+	}
+	tag, err := sql.Execute(ctx, e, statement, a...)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
 }
@@ -0,0 +1,228 @@
+package sculpt
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueryCompile(t *testing.T) {
+	m := conditionUserModel(t)
+
+	tests := []struct {
+		name string
+		q    *Query[conditionUser]
+		want string
+		a    []any
+	}{
+		{
+			name: "all columns",
+			q:    m.Query(),
+			want: `SELECT "id", "name", "age", "email" FROM "conditionuser";`,
+			a:    []any{},
+		},
+		{
+			name: "fields, conditions, order, limit and offset",
+			q: m.Query().
+				IncludeFields("ID", "Name").
+				Conditions(EqualsTo("Name", "a"), Or(LessThan("Age", 1), GreaterThan("Age", 2))).
+				OrderBy("Age", Descending).
+				Limit(3).
+				Offset(4),
+			want: `SELECT "id", "name" FROM "conditionuser" WHERE "name" = $1 AND ("age" < $2 OR "age" > $3) ORDER BY "age" DESC LIMIT $4 OFFSET $5;`,
+			a:    []any{"a", 1, 2, 3, 4},
+		},
+		{
+			name: "distinct",
+			q:    m.Query().Distinct().IncludeFields("Name"),
+			want: `SELECT DISTINCT "name" FROM "conditionuser";`,
+			a:    []any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, a, err := tt.q.compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != tt.want {
+				t.Errorf("statement = %s, want %s", s, tt.want)
+			}
+			if !reflect.DeepEqual(a, tt.a) {
+				t.Errorf("arguments = %v, want %v", a, tt.a)
+			}
+		})
+	}
+}
+
+func TestQueryCompileErrors(t *testing.T) {
+	m := conditionUserModel(t)
+	tests := []struct {
+		name string
+		q    *Query[conditionUser]
+		err  string
+	}{
+		{"unknown condition column", m.Query().Conditions(EqualsTo("Nope", 1)), "condition on Nope"},
+		{"unknown order column", m.Query().OrderBy("Nope", Ascending), "cannot order by Nope"},
+		{"negative limit", m.Query().Limit(-1), "limit cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := tt.q.compile()
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAggregateCompile(t *testing.T) {
+	m := conditionUserModel(t)
+
+	type nameStats struct {
+		Name   string
+		Count  int64
+		Oldest int
+	}
+	aq := Aggregate[nameStats](m.Query().Conditions(IsNotNull("Email")), Count(), Max("Age").As("Oldest")).
+		GroupBy("Name").
+		Having(GreaterThan(Count().String(), 1), LessThan("SUM(Age)", 100), GreaterThan("Oldest", 18))
+	s, a, fields, err := aq.compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `SELECT "name", COUNT(*), MAX("age") FROM "conditionuser" WHERE "email" IS NOT NULL GROUP BY "name" HAVING COUNT(*) > $1 AND SUM("age") < $2 AND MAX("age") > $3;`
+	if s != want {
+		t.Errorf("statement = %s, want %s", s, want)
+	}
+	if !reflect.DeepEqual(a, []any{1, 100, 18}) {
+		t.Errorf("arguments = %v, want [1 100 18]", a)
+	}
+	if !reflect.DeepEqual(fields, []string{"Name", "Count", "Oldest"}) {
+		t.Errorf("fields = %v, want [Name Count Oldest]", fields)
+	}
+}
+
+func TestAggregateCompileWithoutConditions(t *testing.T) {
+	m := conditionUserModel(t)
+	type nameCount struct {
+		Name  string
+		Count int64
+	}
+	s, _, _, err := Aggregate[nameCount](m.Query(), Count()).GroupBy("Name").compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `SELECT "name", COUNT(*) FROM "conditionuser" GROUP BY "name";`; s != want {
+		t.Errorf("statement = %s, want %s", s, want)
+	}
+}
+
+func TestAggregateCompileErrors(t *testing.T) {
+	m := conditionUserModel(t)
+	type result struct{ Count int64 }
+
+	tests := []struct {
+		name string
+		aq   *AggregateQuery[conditionUser, result]
+	}{
+		{"no aggregations", Aggregate[result](m.Query())},
+		{"unknown aggregation column", Aggregate[result](m.Query(), Sum("Nope"))},
+		{"unknown group by column", Aggregate[result](m.Query(), Count()).GroupBy("Nope")},
+		{"unknown having column", Aggregate[result](m.Query(), Count()).Having(EqualsTo("SUM(Nope)", 1))},
+		{"sum without a column", Aggregate[result](m.Query(), Aggregation{function: "SUM"})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := tt.aq.compile(); err == nil {
+				t.Error("compile returned no error")
+			}
+		})
+	}
+}
+
+func TestQueryDeleteErrors(t *testing.T) {
+	m := conditionUserModel(t)
+	cond := EqualsTo("Name", "a")
+	tests := []struct {
+		name string
+		q    *Query[conditionUser]
+		err  string
+	}{
+		{"no conditions", m.Query(), "without conditions"},
+		{"limit", m.Query().Conditions(cond).Limit(1), "limit or offset"},
+		{"offset", m.Query().Conditions(cond).Offset(1), "limit or offset"},
+		{"order", m.Query().Conditions(cond).OrderBy("Age", Ascending), "ordered"},
+		{"distinct", m.Query().Conditions(cond).Distinct(), "distinct"},
+		{"paginated", m.Query().Conditions(cond).PageSize(10), "paginated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the query is rejected before a database is needed
+			_, err := tt.q.Delete()
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want it to contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSelectUnexportedField(t *testing.T) {
+	m := conditionUserModel(t)
+	type summary struct {
+		ID   int
+		name string
+	}
+	// the field is rejected before a database is needed
+	_, err := Select[summary](m.Query())
+	if err == nil || !strings.Contains(err.Error(), "name") {
+		t.Errorf("err = %v, want it to name the unexported field", err)
+	}
+}
+
+type joinCustomer struct {
+	ID      int `pk:"true" autoincrement:"true"`
+	Country string
+}
+
+type joinOrder struct {
+	ID             int `pk:"true" autoincrement:"true"`
+	JoinCustomerID int `references:"joinCustomer"`
+	Total          int
+}
+
+func TestJoinCompile(t *testing.T) {
+	customers, err := New[joinCustomer]()
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders, err := New[joinOrder]()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := orders.Query().
+		Join(customers, "JoinCustomerID", "ID").
+		IncludeFields("ID", "joinCustomer.Country").
+		Conditions(EqualsTo("joinCustomer.Country", "NZ")).
+		OrderBy("joinCustomer.Country", Ascending).
+		OrderBy("joinOrder.Total", Descending)
+	s, a, err := q.compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `SELECT "joinorder"."id", "joincustomer"."country" FROM "joinorder" INNER JOIN "joincustomer" ON "joinorder"."joincustomerid" = "joincustomer"."id" WHERE "joincustomer"."country" = $1 ORDER BY "joincustomer"."country" ASC, "joinorder"."total" DESC;`
+	if s != want {
+		t.Errorf("statement = %s, want %s", s, want)
+	}
+	if !reflect.DeepEqual(a, []any{"NZ"}) {
+		t.Errorf("arguments = %v, want [NZ]", a)
+	}
+
+	if _, err := q.keys(); err == nil {
+		t.Error("keys with a column of a joined model returned no error")
+	}
+	if _, _, err := orders.Query().OrderBy("joinCustomer.Country", Ascending).compile(); err == nil {
+		t.Error("order by a column of a model that is not joined returned no error")
+	}
+}
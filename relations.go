@@ -0,0 +1,224 @@
+package sculpt
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/tiredkangaroo/sculpt/internals/sql"
+)
+
+// registeredModels stores a map of struct types to the columns of the models made with
+// them. It is used in order to load the related models of relations, see Query.Preload.
+// It is guarded by registryMu.
+var registeredModels = make(map[reflect.Type][]Column) // struct type: columns
+
+// registeredColumns returns the columns of the model made with the struct type t.
+func registeredColumns(t reflect.Type) ([]Column, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	columns, ok := registeredModels[t]
+	return columns, ok
+}
+
+// relation represents a field of a Sculpt model that holds rows of another model related
+// to it, rather than a column. It is marked with the relation tag, and loaded with
+// Query.Preload.
+type relation struct {
+	// name specifies the name of the field.
+	name string
+
+	// column is the name of the column that relates the two models. If many is false, it
+	// is a column of this model referencing the related model (the model belongs to the
+	// related model). Otherwise, it is a column of the related model referencing this model
+	// (the model has many of the related model).
+	column string
+
+	// t is the struct type of the related model.
+	t reflect.Type
+
+	// many specifies whether the field is a slice of the related model.
+	many bool
+
+	// pointer specifies whether the field is a pointer to the related model.
+	pointer bool
+}
+
+// handleRelation returns the relation of the field, which has the relation tag.
+func handleRelation(f reflect.StructField) (relation, error) {
+	r := relation{name: f.Name, column: f.Tag.Get("relation"), t: f.Type}
+	if r.column == "" {
+		return r, fmt.Errorf("relation must name a column")
+	}
+	switch {
+	case f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Struct:
+		r.many = true
+		r.t = f.Type.Elem()
+	case f.Type.Kind() == reflect.Pointer && f.Type.Elem().Kind() == reflect.Struct:
+		r.pointer = true
+		r.t = f.Type.Elem()
+	case f.Type.Kind() != reflect.Struct:
+		return r, fmt.Errorf("unsupported type on relation %s: %s", f.Name, f.Type.String())
+	}
+	return r, nil
+}
+
+// validate checks that the column of a relation the model belongs to is a column of the
+// model referencing the related model. The column of a relation the model has many of is
+// on the related model, which may not have been made yet, and so is checked when loaded.
+func (r relation) validate(columns []Column) error {
+	if r.many {
+		return nil
+	}
+	column, ok := columnByName(columns, r.column)
+	if !ok {
+		return fmt.Errorf("column %s is not on the model", r.column)
+	}
+	if column.referencedModel != modelKey(r.t) {
+		return fmt.Errorf("column %s does not reference %s", r.column, r.t.Name())
+	}
+	return nil
+}
+
+// keys returns the column of the model and the column of the related model whose values
+// are equal for related rows. model and columns are the struct type and columns of the model,
+// and related is the columns of the related model.
+func (r relation) keys(model reflect.Type, columns []Column, related []Column) (Column, Column, error) {
+	if !r.many {
+		column, _ := columnByName(columns, r.column)
+		return column, *column.referenced, nil
+	}
+	column, ok := columnByName(related, r.column)
+	if !ok {
+		return Column{}, Column{}, fmt.Errorf("column %s is not on the model %s", r.column, r.t.Name())
+	}
+	if column.referencedModel != modelKey(model) {
+		return Column{}, Column{}, fmt.Errorf("column %s of %s does not reference %s", r.column, r.t.Name(), model.Name())
+	}
+	return *column.referenced, column, nil
+}
+
+// load loads the rows of the related model into the field of each struct in parents, a
+// slice of the model's struct, with one query for every maxParameters distinct keys.
+func (r relation) load(ctx context.Context, e sql.Executor, model reflect.Type, columns []Column, parents reflect.Value) error {
+	related, ok := registeredColumns(r.t)
+	if !ok {
+		return fmt.Errorf("related model %s must be made with New first", r.t.Name())
+	}
+	key, relatedKey, err := r.keys(model, columns, related)
+	if err != nil {
+		return err
+	}
+
+	keys := []any{}
+	seen := make(map[any]bool)
+	for i := range parents.Len() {
+		v := key.fieldValue(parents.Index(i))
+		if v == nil || seen[relationKey(v)] {
+			continue
+		}
+		seen[relationKey(v)] = true
+		keys = append(keys, v)
+	}
+
+	fields := make([]string, len(related))
+	for i, c := range related {
+		fields[i] = sql.Identifier(c.name)
+	}
+	resolve := func(name string) (string, error) {
+		return sql.Identifier(name), nil
+	}
+
+	loaded := make(map[any][]reflect.Value)
+	for chunk := range slices.Chunk(keys, maxParameters) {
+		j := 0
+		where, a, err := In(relatedKey.name, chunk...).compile(resolve, &j)
+		if err != nil {
+			return err
+		}
+		statement := fmt.Sprintf("SELECT %s FROM %s WHERE %s;", strings.Join(fields, ", "), sql.Identifier(r.t.Name()), where)
+		rows, err := sql.Query(ctx, e, statement, a...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			v := reflect.New(r.t).Elem()
+			if err := rows.Scan(scanTargets(v, related)...); err != nil {
+				rows.Close()
+				return err
+			}
+			k := relationKey(relatedKey.fieldValue(v))
+			loaded[k] = append(loaded[k], v)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+
+	for i := range parents.Len() {
+		parent := parents.Index(i)
+		v := key.fieldValue(parent)
+		if v == nil {
+			continue
+		}
+		values := loaded[relationKey(v)]
+		field := parent.FieldByName(r.name)
+		switch {
+		case r.many:
+			field.Set(reflect.Append(reflect.MakeSlice(field.Type(), 0, len(values)), values...))
+		case len(values) == 0:
+			// the referenced row does not exist, and so the field is left as is
+		case r.pointer:
+			p := reflect.New(r.t)
+			p.Elem().Set(values[0])
+			field.Set(p)
+		default:
+			field.Set(values[0])
+		}
+	}
+	return nil
+}
+
+// relationKey returns the value of a column of a relation in a form that can be used as a
+// map key, since a []byte cannot be.
+func relationKey(v any) any {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+		return string(rv.Bytes())
+	}
+	return v
+}
+
+// Preload loads the related models of the given relation fields when the query is done.
+// Each relation is loaded with one more query for all of the results, instead of one for
+// each result. Preload cannot be used with Iter.
+//
+// An error is returned when the query is done if a field is not a relation on the model.
+func (q *Query[T]) Preload(relations ...string) *Query[T] {
+	for _, name := range relations {
+		if _, ok := q.model.relation(name); !ok {
+			q.err = fmt.Errorf("cannot preload %s: field is not a relation on the model", name)
+			return q
+		}
+		q.preloads = append(q.preloads, name)
+	}
+	return q
+}
+
+// preload loads the relations given to Preload into the results.
+func (q *Query[T]) preload(ctx context.Context, e sql.Executor, results []T) error {
+	if len(results) == 0 {
+		return nil
+	}
+	parents := reflect.ValueOf(results)
+	for _, name := range q.preloads {
+		r, _ := q.model.relation(name)
+		if err := r.load(ctx, e, q.model.t, q.model.columns, parents); err != nil {
+			return fmt.Errorf("cannot preload %s: %v", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package sculpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/tiredkangaroo/sculpt/internals/sql"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxParameters is the maximum number of parameters Postgres allows in one statement.
+const maxParameters = 65535
+
+// SaveMany uses the Postgres connection to save every struct into the database table.
+// Every struct is validated with the column validators before any are saved.
+//
+// The structs are streamed to Postgres with the COPY protocol. If a struct leaves a column
+// with a default as a nil Optional, multi-row INSERT statements are used instead, since COPY
+// cannot use the default of a column for some rows and not others. Either way, the structs
+// are saved atomically: if there is more than one statement, they are run in a transaction
+// (or a savepoint, if the model is bound to a transaction).
+func (m *Model[T]) SaveMany(vs []T) error {
+	return m.SaveManyContext(context.Background(), vs)
+}
+
+// SaveManyContext is like SaveMany, but uses the given context for the statements.
+func (m *Model[T]) SaveManyContext(ctx context.Context, vs []T) error {
+	if len(vs) == 0 {
+		return nil
+	}
+	if len(m.columns) == 0 {
+		return fmt.Errorf("cannot save many of %s: model has no columns", m.name)
+	}
+	e, err := m.executor()
+	if err != nil {
+		return err
+	}
+
+	rvs := reflect.ValueOf(vs)
+	columns := []Column{}
+	for _, column := range m.columns {
+		if !column.autoincrement {
+			columns = append(columns, column)
+		}
+	}
+
+	rows := make([][]any, rvs.Len())
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+	}
+	for i := range rvs.Len() {
+		rv := rvs.Index(i)
+		row := make([]any, len(columns))
+		for j, column := range columns {
+			if column.usesDefault(rv) {
+				// COPY cannot use the default for this row alone
+				return m.saveManyInsert(ctx, e, rvs, false)
+			}
+			if row[j], err = column.value(rv); err != nil {
+				return err
+			}
+		}
+		rows[i] = row
+	}
+
+	_, err = sql.CopyFrom(ctx, e, m.name, names, rows)
+	return err
+}
+
+// SaveManyReturning is like SaveMany, but the values given by the database to autoincrement
+// columns, and to columns with a default, are set on the structs in vs.
+//
+// Since COPY cannot return values, and the rows returned by a multi-row INSERT are not
+// guaranteed to be in the order of its values, each struct is saved with its own INSERT
+// statement with RETURNING. The statements are sent in one round trip, and run in a
+// transaction (or a savepoint, if the model is bound to a transaction).
+func (m *Model[T]) SaveManyReturning(vs []T) error {
+	return m.SaveManyReturningContext(context.Background(), vs)
+}
+
+// SaveManyReturningContext is like SaveManyReturning, but uses the given context for the
+// statements.
+func (m *Model[T]) SaveManyReturningContext(ctx context.Context, vs []T) error {
+	if len(vs) == 0 {
+		return nil
+	}
+	if len(m.columns) == 0 {
+		return fmt.Errorf("cannot save many of %s: model has no columns", m.name)
+	}
+	e, err := m.executor()
+	if err != nil {
+		return err
+	}
+	return m.saveManyInsert(ctx, e, reflect.ValueOf(vs), true)
+}
+
+// saveManyInsert saves the structs in rvs, a reflected slice of the model's structs. If
+// returning is false, multi-row INSERT statements are used. Otherwise, the rows returned by a
+// multi-row INSERT are not guaranteed to be in the order of its values, and so each struct is
+// inserted with its own statement, sent in one batch, and the values given by the database are
+// set on it. If there is more than one statement, they are run in a transaction so that the
+// structs are saved atomically.
+func (m *Model[T]) saveManyInsert(ctx context.Context, e sql.Executor, rvs reflect.Value, returning bool) (err error) {
+	if returning {
+		return m.saveManyReturning(ctx, e, rvs)
+	}
+
+	// validate every struct before saving any of them
+	values := make([][]any, rvs.Len())
+	for i := range rvs.Len() {
+		rv := rvs.Index(i)
+		values[i] = make([]any, len(m.columns))
+		for j, column := range m.columns {
+			if column.usesDefault(rv) {
+				continue
+			}
+			value, err := column.value(rv)
+			if err != nil {
+				return err
+			}
+			values[i][j] = value
+		}
+	}
+
+	chunk := maxParameters / len(m.columns)
+	if rvs.Len() > chunk {
+		tx, err := e.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() { err = endSaveMany(ctx, tx, err) }()
+		e = tx
+	}
+	for start := 0; start < rvs.Len(); start += chunk {
+		end := min(start+chunk, rvs.Len())
+		statement, a := m.compileInsertMany(rvs.Slice(start, end), values[start:end])
+		if _, err := sql.Execute(ctx, e, statement+`;`, a...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveManyReturning inserts each struct in rvs with its own INSERT ... RETURNING statement,
+// and scans the row returned for it into its columns given by the database.
+func (m *Model[T]) saveManyReturning(ctx context.Context, e sql.Executor, rvs reflect.Value) (err error) {
+	b := &pgx.Batch{}
+	returned := make([][]Column, rvs.Len())
+	for i := range rvs.Len() {
+		statement, a, columns, err := m.compileSave(rvs.Index(i), true)
+		if err != nil {
+			return err
+		}
+		b.Queue(statement, a...)
+		returned[i] = columns
+	}
+
+	if rvs.Len() > 1 {
+		tx, err := e.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		defer func() { err = endSaveMany(ctx, tx, err) }()
+		e = tx
+	}
+	br := sql.SendBatch(ctx, e, b)
+	defer br.Close()
+	for i := range rvs.Len() {
+		rows, err := br.Query()
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if len(returned[i]) > 0 && rows.Next() {
+			if err := rows.Scan(scanTargets(rvs.Index(i), returned[i])...); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return br.Close()
+}
+
+// endSaveMany commits the transaction of a SaveMany if err is nil, and rolls it back
+// otherwise. It returns the error of the SaveMany, joined with the error of rolling back.
+func endSaveMany(ctx context.Context, tx pgx.Tx, err error) error {
+	if err == nil {
+		return tx.Commit(ctx)
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+	if rerr := tx.Rollback(ctx); rerr != nil {
+		return errors.Join(err, fmt.Errorf("cannot roll back transaction: %w", rerr))
+	}
+	return err
+}
+
+// compileInsertMany makes a multi-row INSERT INTO ... VALUES (...), (...) statement for the
+// structs in rvs, with values holding the validated values of their columns. It returns the
+// statement with the pgx arguments for it.
+func (m *Model[T]) compileInsertMany(rvs reflect.Value, values [][]any) (string, []any) {
+	names := make([]string, len(m.columns))
+	for i, column := range m.columns {
+		names[i] = sql.Identifier(column.name)
+	}
+	statement := fmt.Sprintf(`INSERT INTO %s (%s) VALUES `, sql.Identifier(m.name), strings.Join(names, `, `))
+
+	a := []any{}
+	for i := range rvs.Len() {
+		rv := rvs.Index(i)
+		if i > 0 {
+			statement += `, `
+		}
+		statement += `(`
+		for j, column := range m.columns {
+			if j > 0 {
+				statement += `, `
+			}
+			if column.usesDefault(rv) {
+				statement += `DEFAULT`
+				continue
+			}
+			a = append(a, values[i][j])
+			statement += fmt.Sprintf(`$%d`, len(a))
+		}
+		statement += `)`
+	}
+	return statement, a
+}
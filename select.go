@@ -0,0 +1,173 @@
+package sculpt
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/tiredkangaroo/sculpt/internals/sql"
+)
+
+// Select compiles and executes the query, projecting the results into R. See SelectContext
+// for more information.
+func Select[R any, T any](q *Query[T]) ([]R, error) {
+	return SelectContext[R](context.Background(), q)
+}
+
+// SelectContext is like Select, but uses the given context for the query.
+//
+// R must be a struct whose fields are exported, and each have the same name and type as a
+// field of the model, and only those columns are selected. It is useful for loading a smaller struct, without
+// columns that are large or unneeded.
+//
+//	type UserSummary struct {
+//		ID   int
+//		Name string
+//	}
+//	summaries, err := sculpt.Select[UserSummary](userModel.Query())
+//
+// A field of R can also be the struct of the model or of a model joined with the query (see
+// Query.Join), embedded or not, into which every column of that model is scanned. With
+// LeftJoin, the field should be a pointer to the struct, which is nil when there is no row
+// of the joined model.
+//
+//	type OrderWithCustomer struct {
+//		Order
+//		Customer *Customer
+//	}
+//	results, err := sculpt.Select[OrderWithCustomer](
+//		orderModel.Query().LeftJoin(customerModel, "CustomerID", "ID"),
+//	)
+func SelectContext[R any, T any](ctx context.Context, q *Query[T]) ([]R, error) {
+	rt := reflect.TypeFor[R]()
+	if rt.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("type parameter R must be a struct")
+	}
+
+	expressions := []string{}
+	projections := make([]projection, rt.NumField())
+	for i := range rt.NumField() {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			return nil, fmt.Errorf("field %s is unexported, and so cannot be scanned into", field.Name)
+		}
+		projections[i].index = i
+
+		t := field.Type
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if table, ok := q.tableOf(t); ok {
+			projections[i].columns = table.columns
+			projections[i].model = true
+			projections[i].pointer = field.Type.Kind() == reflect.Pointer
+			for _, column := range table.columns {
+				expressions = append(expressions, q.identifier(table.name, column.name))
+			}
+			continue
+		}
+
+		column, ok := q.model.column(field.Name)
+		if !ok {
+			return nil, fmt.Errorf("field %s is not on the model", field.Name)
+		}
+		if field.Type != column.t {
+			return nil, fmt.Errorf("field %s has type %s, but the model's field has type %s", field.Name, field.Type, column.t)
+		}
+		projections[i].columns = []Column{column}
+		expressions = append(expressions, q.identifier(q.model.name, column.name))
+	}
+
+	statement, a, err := q.compileSelect(expressions)
+	if err != nil {
+		return nil, err
+	}
+	e, err := q.model.executor()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := sql.Query(ctx, e, statement, a...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []R{}
+	for rows.Next() {
+		result := reflect.New(rt).Elem()
+		targets := make([][]any, len(projections))
+		all := []any{}
+		for i, p := range projections {
+			targets[i] = p.targets(result)
+			all = append(all, targets[i]...)
+		}
+		if err := rows.Scan(all...); err != nil {
+			return nil, err
+		}
+		for i, p := range projections {
+			p.set(result, targets[i])
+		}
+		results = append(results, result.Interface().(R))
+	}
+	return results, rows.Err()
+}
+
+// projection is a field of the struct a query is selected into, and the columns scanned
+// into it.
+type projection struct {
+	// index is the index of the field in the struct.
+	index int
+
+	// columns are the columns scanned into the field. If model is false, it is the only
+	// column, scanned into the field itself.
+	columns []Column
+
+	// model specifies whether the field is the struct of a model, whose columns are scanned
+	// into its fields.
+	model bool
+
+	// pointer specifies whether the field is a pointer to the struct of a model. It is left
+	// nil if every column is null, such as when there is no row of a model joined with
+	// LeftJoin.
+	pointer bool
+}
+
+// targets returns the targets that the columns of the projection are scanned into, for
+// the struct rv.
+func (p projection) targets(rv reflect.Value) []any {
+	field := rv.Field(p.index)
+	switch {
+	case !p.model:
+		return []any{field.Addr().Interface()}
+	case !p.pointer:
+		return scanTargets(field, p.columns)
+	}
+	// the columns are scanned into pointers, which are nil for nulls, and set by set
+	targets := make([]any, len(p.columns))
+	for i, column := range p.columns {
+		targets[i] = reflect.New(reflect.PointerTo(column.t)).Interface()
+	}
+	return targets
+}
+
+// set sets the field of the projection in the struct rv from targets, which were made by
+// targets and scanned into.
+func (p projection) set(rv reflect.Value, targets []any) {
+	if !p.pointer {
+		return // scanned directly into the field
+	}
+	field := rv.Field(p.index)
+	v := reflect.New(field.Type().Elem())
+	found := false
+	for i, column := range p.columns {
+		target := reflect.ValueOf(targets[i]).Elem()
+		if target.IsNil() {
+			continue
+		}
+		v.Elem().FieldByName(column.name).Set(target.Elem())
+		found = true
+	}
+	if found {
+		field.Set(v)
+	}
+}
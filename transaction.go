@@ -0,0 +1,218 @@
+package sculpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// IsolationLevel is the isolation level of a transaction.
+type IsolationLevel uint8
+
+const (
+	// DefaultIsolation uses the default isolation level of the database.
+	DefaultIsolation IsolationLevel = iota
+	ReadUncommitted
+	ReadCommitted
+	RepeatableRead
+	Serializable
+)
+
+// pgx returns the pgx equivalent of the isolation level.
+func (l IsolationLevel) pgx() pgx.TxIsoLevel {
+	switch l {
+	case ReadUncommitted:
+		return pgx.ReadUncommitted
+	case ReadCommitted:
+		return pgx.ReadCommitted
+	case RepeatableRead:
+		return pgx.RepeatableRead
+	case Serializable:
+		return pgx.Serializable
+	default:
+		return ""
+	}
+}
+
+// TxOptions configures a transaction started with DB.TxWithOptions.
+type TxOptions struct {
+	// IsolationLevel is the isolation level of the transaction.
+	IsolationLevel IsolationLevel
+
+	// ReadOnly specifies whether the transaction is read-only.
+	ReadOnly bool
+
+	// Retry specifies how the transaction is retried when it fails with a serialization
+	// failure or a deadlock. By default, the transaction is not retried.
+	Retry RetryPolicy
+}
+
+// pgx returns the pgx equivalent of the transaction options.
+func (o TxOptions) pgx() pgx.TxOptions {
+	options := pgx.TxOptions{IsoLevel: o.IsolationLevel.pgx()}
+	if o.ReadOnly {
+		options.AccessMode = pgx.ReadOnly
+	}
+	return options
+}
+
+// RetryPolicy specifies how a transaction is retried when it fails with a serialization
+// failure (SQLSTATE 40001) or a deadlock (SQLSTATE 40P01). Between attempts, the
+// transaction waits for a backoff that doubles after every attempt.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times the transaction is attempted. A value
+	// of 1 or less disables retrying.
+	MaxAttempts int
+
+	// InitialBackoff is the wait before the second attempt. It defaults to 10ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the wait between attempts. It defaults to 1s.
+	MaxBackoff time.Duration
+}
+
+// backoff returns how long to wait after the given (1-based) attempt failed.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	initial, max := p.InitialBackoff, p.MaxBackoff
+	if initial <= 0 {
+		initial = 10 * time.Millisecond
+	}
+	if max <= 0 {
+		max = time.Second
+	}
+	backoff := initial
+	for i := 1; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+	return min(backoff, max)
+}
+
+// RetryError is returned when a transaction fails with a retryable error on every
+// attempt allowed by its RetryPolicy.
+type RetryError struct {
+	// Attempts is the number of times the transaction was attempted.
+	Attempts int
+
+	// Err is the error from the last attempt.
+	Err error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("transaction failed after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// retryable returns whether the error is a serialization failure or a deadlock, meaning
+// the transaction can be retried.
+func retryable(err error) bool {
+	var pgerr *pgconn.PgError
+	if !errors.As(err, &pgerr) {
+		return false
+	}
+	return pgerr.Code == "40001" || pgerr.Code == "40P01"
+}
+
+// Tx is a transaction in progress. Models are bound to a transaction with Model.In.
+type Tx struct {
+	tx pgx.Tx
+
+	// ctx is the context the transaction was started with. It is used by Nested.
+	ctx context.Context
+
+	// attempt is the (1-based) attempt number of the transaction.
+	attempt int
+}
+
+// Attempt returns which attempt the transaction is, starting at 1. It is greater than
+// 1 when the transaction is being retried, see RetryPolicy.
+func (tx *Tx) Attempt() int {
+	return tx.attempt
+}
+
+// Nested runs fn inside of a nested transaction, using the context the transaction was
+// started with. See NestedContext for more information.
+func (tx *Tx) Nested(fn func(tx *Tx) error) error {
+	return tx.NestedContext(tx.ctx, fn)
+}
+
+// NestedContext runs fn inside of a nested transaction, made with a SAVEPOINT. If fn
+// returns nil the savepoint is released, and if fn returns an error or panics the
+// transaction is rolled back to the savepoint, leaving the outer transaction usable.
+func (tx *Tx) NestedContext(ctx context.Context, fn func(tx *Tx) error) error {
+	// pgx makes a savepoint when beginning a transaction inside of a transaction
+	ptx, err := tx.tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	return runTx(ctx, &Tx{tx: ptx, ctx: ctx, attempt: tx.attempt}, fn)
+}
+
+// Tx runs fn inside of a transaction, with the default transaction options. See
+// TxWithOptions for more information.
+func (db *DB) Tx(ctx context.Context, fn func(tx *Tx) error) error {
+	return db.TxWithOptions(ctx, TxOptions{}, fn)
+}
+
+// TxWithOptions begins a transaction with the given options and runs fn inside of it.
+// The transaction is committed if fn returns nil, and rolled back if fn returns an
+// error or panics. A panic is propagated after the transaction is rolled back.
+//
+// If the options have a RetryPolicy, fn may be called more than once, and so it should
+// not have side effects outside of the transaction. A *RetryError is returned when
+// every attempt fails with a retryable error.
+func (db *DB) TxWithOptions(ctx context.Context, options TxOptions, fn func(tx *Tx) error) error {
+	for attempt := 1; ; attempt++ {
+		ptx, err := db.pool.BeginTx(ctx, options.pgx())
+		if err != nil {
+			return err
+		}
+		err = runTx(ctx, &Tx{tx: ptx, ctx: ctx, attempt: attempt}, fn)
+		if err == nil || !retryable(err) || options.Retry.MaxAttempts <= 1 {
+			return err
+		}
+		if attempt >= options.Retry.MaxAttempts {
+			return &RetryError{Attempts: attempt, Err: err}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(options.Retry.backoff(attempt)):
+		}
+	}
+}
+
+// rollbackTimeout caps how long rolling back a transaction can take.
+const rollbackTimeout = 5 * time.Second
+
+// runTx runs fn inside of the transaction, committing or rolling back the transaction
+// depending on the outcome of fn.
+func runTx(ctx context.Context, tx *Tx, fn func(tx *Tx) error) error {
+	// a cancelled ctx is often why fn failed, but the rollback must still be sent
+	rollback := func() error {
+		rctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+		defer cancel()
+		return tx.tx.Rollback(rctx)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			rollback() // the panic is more useful than the error from rolling back
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rerr := rollback(); rerr != nil {
+			return errors.Join(err, fmt.Errorf("cannot roll back transaction: %w", rerr))
+		}
+		return err
+	}
+	return tx.tx.Commit(ctx)
+}